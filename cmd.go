@@ -94,17 +94,22 @@ func (op *Options) SurveyCmd() error {
 }
 
 func MultiSelectCmd(list BlobList) []string {
-
-	selected := []string{}
 	targets := []string{}
 
 	for _, item := range list {
 		ele := item.oid + ": " + item.objectName + "\n"
 		targets = append(targets, ele)
 	}
+	return MultiSelect(LocalSprintf("multi select message"), targets)
+}
+
+// MultiSelect asks the user to select some of the options
+func MultiSelect(message string, options []string) []string {
+	selected := []string{}
+
 	prompt := &survey.MultiSelect{
-		Message:  LocalSprintf("multi select message") + "\n",
-		Options:  targets,
+		Message:  message + "\n",
+		Options:  options,
 		PageSize: 10,
 		Help:     LocalSprintf("multi select help info"),
 	}
@@ -139,6 +144,20 @@ func Confirm(list []string) (bool, []string) {
 	return ok, results
 }
 
+func ConfirmSecrets() bool {
+	ok := false
+
+	prompt := &survey.Confirm{
+		Message: LocalSprintf("confirm secrets message") + "\n",
+	}
+	err := survey.AskOne(prompt, &ok)
+	if err == terminal.InterruptErr {
+		PrintLocalWithRedln("process interrupted")
+		os.Exit(1)
+	}
+	return ok
+}
+
 func AskForMigrateToLFS() bool {
 	ok := false
 
@@ -1,135 +1,278 @@
 package main
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
+
+	"gitee.com/oscstudio/git-repo-clean/rewrite"
 )
 
-// tweak git objects
+// Repository is the rewrite.Filter built from the command line options,
+// it drops(or converts into LFS) the files selected by scan or by filters.
 
-func (repo *Repository) tweak_blob(blob *Blob) {
+func (repo *Repository) TweakBlob(blob *rewrite.Blob) {
+	// converted into LFS by rewrite.LFSConverter while being parsed
+	if repo.context.opts.lfs {
+		return
+	}
 	for _, target := range repo.filtered {
-		if target == blob.original_oid {
-			// replace old blob with new LFS info
-			if repo.context.opts.lfs {
-				ConvertToLFSObj(blob)
-				UpdateBlob(blob)
-				break
-			}
+		if target == blob.OriginalOid {
 			// set new id to 0
-			blob.ele.skip(0)
+			blob.Skip()
 		}
 	}
 }
 
-func (repo *Repository) tweak_commit(commit *Commit, helper *Helper_info) {
-	// 如果没有parent, 且也没有filechange，则first commit是empty commit
-	if len(commit.parents) == 0 && len(commit.filechanges) == 0 {
-		return
+func (repo *Repository) TweakFileChange(commit *rewrite.Commit, filechange *rewrite.FileChange) bool {
+	// the blobs to convert into LFS are selected beforehand, and replaced
+	// by TweakBlob, the file changes are kept
+	if repo.context.opts.lfs {
+		return true
 	}
-	// 如果有parent，但是没有filechange， 则可能是merge commit, 或者连续的empty commit
-	if len(commit.parents) != 0 && len(commit.filechanges) == 0 {
-		return
+	matched := false
+	// a mark id when the blob data is exported too, e.g. with '--replace-text'
+	oid := repo.session.BlobOid(filechange.BlobID)
+	// scan mode, filter by blob oid
+	if repo.context.opts.scan || repo.context.opts.secrets {
+		for _, target := range repo.filtered {
+			if oid != "" && target == oid {
+				matched = true
+				break
+			}
+		}
+	} else {
+		// filter by blob size threshold
+		if repo.context.scan_t.filesize {
+			size := repo.context.BlobSize(oid)
+			limit, err := UnitConvert(repo.context.opts.limit)
+			if err != nil {
+				ft := LocalPrinter().Sprintf("convert uint error: %s", err)
+				PrintRedln(ft)
+				os.Exit(1)
+			}
+			if size > limit {
+				matched = true
+			}
+		}
+		// filter by file type
+		if repo.context.scan_t.filetype && MatchFileType([]string{rewrite.UnquotePath(filechange.Filepath)}, repo.context.opts.types) {
+			matched = true
+		}
+		// filter by blob name or directory
+		// with '--keep-only', files not matched are removed instead
+		if repo.context.scan_t.filepath &&
+			repo.context.paths.Match(rewrite.UnquotePath(filechange.Filepath)) != repo.context.opts.keeponly {
+			matched = true
+		}
 	}
-	// 如果有parent，且from：0, 说明是从第一个blob就开始删除了
-	if len(commit.parents) != 0 && commit.parents[0] == 0 {
-		commit.skip(0)
+	if matched {
+		// skip this file
+		repo.context.branch_changed.Add(strings.TrimSpace(filechange.Branch))
+		return false
 	}
+	return true
+}
 
-	old_1st_parent := commit.first_parent()
+func (repo *Repository) TweakCommit(commit *rewrite.Commit, helper *rewrite.HelperInfo) {}
 
-	filter_filechange(commit, repo)
+func (repo *Repository) TweakReset(reset *rewrite.Reset) {}
 
-	if len(commit.filechanges) == 0 {
-		commit.skip(old_1st_parent)
-	}
+func (repo *Repository) TweakTag(tag *rewrite.Tag) {}
 
-	// 如果 from-id 在ID-hash中能够查询到，则正常，否则说明parent commit被删了
-	// 或者，如果from-id在Skipped-commit中能够查询到，则也需要skip
-	if SKIPPED_COMMITS.Contains(old_1st_parent) {
-		commit.skip(old_1st_parent)
+// LFSConverter streams the blobs selected by scan or by filters into the
+// LFS storage
+func (repo *Repository) LFSConverter() *rewrite.LFSConverter {
+	filtered := make(map[string]bool)
+	for _, oid := range repo.filtered {
+		filtered[oid] = true
+	}
+	return &rewrite.LFSConverter{
+		Dir: repo.context.LFSDir(),
+		Select: func(blob *rewrite.Blob) bool {
+			return filtered[blob.OriginalOid]
+		},
 	}
 }
 
-func filter_filechange(commit *Commit, repo *Repository) {
-	newfilechanges := make([]FileChange, 0)
-	matched := false
-	for _, filechange := range commit.filechanges {
-		// scan mode, filter by blob oid
-		if repo.context.opts.scan {
-			for _, target := range repo.filtered {
-				if len(filechange.blob_id) == 40 {
-					if target == filechange.blob_id {
-						Branch_changed.Add(filechange.branch)
-						matched = true
-						break // break inner for-loop
-					}
-				} else {
-					if filechange.changetype == "M" {
-						id, _ := strconv.Atoi(filechange.blob_id)
-						if _, ok := ID_HASH[int32(id)]; !ok {
-							Branch_changed.Add(filechange.branch)
-							matched = true
-							break // break inner for-loop
-						}
-					}
-				}
-			}
+func (repo *Repository) Parser() {
+	if repo.context.opts.verbose {
+		if repo.context.opts.lfs {
+			PrintLocalWithGreenln("start to migrate specified files")
 		} else {
-			// filter by blob size threshold
-			if repo.context.scan_t.filesize {
-				objectsize := Blob_size_list[filechange.blob_id]
-				// set bitsize to 64, means max single blob size is 4 GiB
-				size, _ := strconv.ParseUint(objectsize, 10, 64)
-				limit, err := UnitConvert(repo.context.opts.limit)
-				if err != nil {
-					ft := LocalPrinter().Sprintf("convert uint error: %s", err)
-					PrintRedln(ft)
-					os.Exit(1)
-				}
-				if size > limit {
-					Branch_changed.Add(filechange.branch)
-					matched = true
-				}
-			}
-			// filter by file type
-			if repo.context.scan_t.filetype && (filepath.Ext(filechange.filepath) == "."+repo.context.opts.types) {
-				Branch_changed.Add(filechange.branch)
-				matched = true
-			}
-			// filter by blob name or directory
-			if repo.context.scan_t.filepath {
-				for _, path := range repo.context.opts.files {
-					matches := Match(path, EndcodePath(TrimeDoubleQuote(filechange.filepath)))
-					if len(matches) != 0 {
-						Branch_changed.Add(filechange.branch)
-						matched = true
-					}
-				}
-			}
+			PrintLocalWithGreenln("start to clean up specified files")
 		}
-		if matched {
-			// skip this file
-			continue
+	}
+
+	rewriter := &rewrite.Rewriter{
+		Repo: &rewrite.Repository{
+			GitBin:  repo.context.gitBin,
+			WorkDir: repo.context.workDir,
+		},
+		Session:  repo.session,
+		Filter:   repo,
+		Branch:   repo.context.opts.branch,
+		Refs:     repo.context.opts.refs,
+		WithData: repo.context.opts.lfs,
+		DryRun:   repo.context.opts.dryrun,
+		MapDir:   filepath.Join(repo.context.gitDir, "repo-clean"),
+
+		RewriteOids: repo.context.opts.msgoids,
+	}
+	// already validated by ParseOptions
+	rewriter.PathRenames, _ = repo.context.opts.PathRenames()
+	rewriter.RefRenames, _ = repo.context.opts.RefRenames()
+	rewriter.ReplaceText, _ = repo.context.opts.ReplaceRules()
+	rewriter.ReplaceText = append(rewriter.ReplaceText, repo.context.redactions...)
+	rewriter.MessageFilter, _ = repo.context.opts.MessageFilter()
+	if repo.context.opts.lfs {
+		rewriter.LFSAttributes = repo.context.LFSPatterns()
+		rewriter.LFS = repo.LFSConverter()
+	}
+	if repo.context.opts.lfsexport {
+		rewriter.LFSExport = &rewrite.LFSExporter{Dir: repo.context.LFSDir()}
+	}
+	if repo.context.opts.mailmap != "" || repo.context.opts.repomailmap {
+		rewriter.Mailmap = repo.Mailmap(rewriter.Repo)
+	}
+	// replace text and LFS export need blob data too
+	rewriter.WithData = rewriter.WithData || len(rewriter.ReplaceText) != 0 || rewriter.LFSExport != nil
+	if err := rewriter.Run(); err != nil {
+		if err == rewrite.ErrNestedTags {
+			PrintLocalWithRedln("nested tags error")
+			os.Exit(1)
 		}
-		// otherwise, keep it in newfilechange
-		newfilechanges = append(newfilechanges, filechange)
+		PrintLocalWithRedln("run git-fast-import process failed")
+		PrintRedln(err.Error())
+		// the repository may be half rewritten, don't clean it up
+		os.Exit(1)
+	}
+	// e.g. files are relocated without being removed
+	for _, commit := range append(rewriter.Report.DroppedCommits, rewriter.Report.RewrittenCommits...) {
+		repo.context.branch_changed.Add(commit.Branch)
+	}
+	// refs which are renamed or deleted without any commit being rewritten
+	for _, ref := range rewriter.Report.RenamedRefs {
+		repo.context.branch_changed.Add(ref)
+	}
+	for _, ref := range rewriter.Report.DeletedRefs {
+		repo.context.branch_changed.Add(ref)
+	}
+	if repo.context.opts.lfsexport {
+		ShowMissingLFSObjects(rewriter.Report, repo.context.LFSDir())
+	}
+	if repo.context.opts.dryrun {
+		repo.ShowDryRunReport(rewriter.Report)
+	} else if repo.context.opts.verbose {
+		PrintYellowln(LocalPrinter().Sprintf("commit-map and ref-map are written into: %s", rewriter.MapDir))
 	}
-	commit.filechanges = newfilechanges
 }
 
-func (repo *Repository) tweak_reset(reset *Reset) {
-	if SKIPPED_COMMITS.Contains(reset.from) {
-		reset.base.dumped = false
-		reset.base.skip()
+// Mailmap merges the .mailmap of the repo and the file of '--mailmap',
+// the latter takes precedence
+func (repo *Repository) Mailmap(r *rewrite.Repository) *rewrite.Mailmap {
+	mailmap := rewrite.NewMailmap()
+	if repo.context.opts.repomailmap {
+		m, err := r.ReadRepoMailmap()
+		if err != nil {
+			ft := LocalPrinter().Sprintf("read mailmap error: %s", err)
+			PrintRedln(ft)
+			os.Exit(1)
+		}
+		mailmap.Merge(m)
+	}
+	if repo.context.opts.mailmap != "" {
+		// already validated by ParseOptions
+		m, _ := rewrite.ReadMailmap(repo.context.opts.mailmap)
+		mailmap.Merge(m)
 	}
+	return mailmap
 }
 
-func (repo *Repository) tweak_tag(tag *Tag) {
-	// the tag may have no parent, if so skip it
-	if SKIPPED_COMMITS.Contains(tag.from_ref) {
-		tag.ele.base.dumped = false
-		tag.ele.skip(0)
+// ShowDryRunReport prints what the history rewrite would change
+func (repo *Repository) ShowDryRunReport(report *rewrite.Report) {
+	PrintLocalWithGreenln("dry run done!")
+	if len(report.DroppedCommits) == 0 && len(report.RewrittenCommits) == 0 &&
+		len(report.RemovedFiles) == 0 && len(report.DeletedRefs) == 0 && len(report.RenamedRefs) == 0 &&
+		len(report.RedactedBlobs) == 0 && len(report.ExportedBlobs) == 0 && report.FreedBytes == 0 {
+		PrintLocalWithYellowln("nothing would be changed")
+		return
+	}
+
+	if len(report.DroppedCommits) != 0 {
+		PrintYellowln(LocalPrinter().Sprintf("commits would be dropped: %d", len(report.DroppedCommits)))
+		for _, commit := range report.DroppedCommits {
+			fmt.Printf("  %s %s %s\n", commit.OriginalOid, commit.Branch, commit.Subject)
+		}
+	}
+	if len(report.RewrittenCommits) != 0 {
+		PrintYellowln(LocalPrinter().Sprintf("commits would be rewritten: %d", len(report.RewrittenCommits)))
+		for _, commit := range report.RewrittenCommits {
+			fmt.Printf("  %s %s %s\n", commit.OriginalOid, commit.Branch, commit.Subject)
+		}
+	}
+
+	branches := make([]string, 0, len(report.RemovedFiles))
+	for branch := range report.RemovedFiles {
+		branches = append(branches, branch)
+	}
+	sort.Strings(branches)
+	for _, branch := range branches {
+		PrintYellowln(LocalPrinter().Sprintf("filechanges would be removed from %s:", branch))
+		for _, filechange := range report.RemovedFiles[branch] {
+			fmt.Printf("  %s %s\n", filechange.ChangeType, filechange.Filepath)
+		}
+	}
+
+	if len(report.SkippedResets) != 0 || len(report.SkippedTags) != 0 {
+		PrintLocalWithYellowln("refs would be skipped:")
+		for _, ref := range report.SkippedResets {
+			fmt.Printf("  reset %s\n", ref)
+		}
+		for _, tag := range report.SkippedTags {
+			fmt.Printf("  tag %s\n", tag)
+		}
+	}
+
+	if len(report.RedactedBlobs) != 0 {
+		PrintYellowln(LocalPrinter().Sprintf("files would be redacted: %d", len(report.RedactedBlobs)))
+		for _, oid := range report.RedactedBlobs {
+			fmt.Printf("  %s\n", oid)
+		}
+	}
+	if len(report.ExportedBlobs) != 0 {
+		PrintYellowln(LocalPrinter().Sprintf("files would be exported from LFS: %d", len(report.ExportedBlobs)))
+		for _, oid := range report.ExportedBlobs {
+			fmt.Printf("  %s\n", oid)
+		}
+	}
+	if len(report.DeletedRefs) != 0 {
+		PrintLocalWithYellowln("refs would be deleted:")
+		for _, ref := range report.DeletedRefs {
+			fmt.Printf("  %s\n", ref)
+		}
+	}
+	if len(report.RenamedRefs) != 0 {
+		PrintLocalWithYellowln("refs would be renamed:")
+		refs := make([]string, 0, len(report.RenamedRefs))
+		for ref := range report.RenamedRefs {
+			refs = append(refs, ref)
+		}
+		sort.Strings(refs)
+		for _, ref := range refs {
+			fmt.Printf("  %s -> %s\n", ref, report.RenamedRefs[ref])
+		}
+	}
+
+	// blobs carried by the stream are counted by the rewriter,
+	// the others are looked up from the scanned blob list
+	freed := uint64(report.FreedBytes)
+	for _, oid := range report.FreedBlobs() {
+		size, _ := strconv.ParseUint(repo.context.blob_size_list[oid], 10, 64)
+		freed += size
 	}
+	PrintYellowln(LocalPrinter().Sprintf("about %d bytes would be freed", freed))
 }
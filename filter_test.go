@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	mapset "github.com/deckarep/golang-set"
+
+	"gitee.com/oscstudio/git-repo-clean/rewrite"
+)
+
+func TestTweakFileChange(t *testing.T) {
+	target := "78981922613b2afb6025042ff6bd878ac1994e85"
+	other := "4a7c8a1f2c4e1b0a9d5b1b5e7c1b6a2d8f9e0c11"
+	repo := &Repository{
+		context: &Context{
+			opts:           &Options{scan: true},
+			branch_changed: mapset.NewSet(),
+		},
+		session:  rewrite.NewSession(),
+		filtered: []string{target},
+	}
+	commit := &rewrite.Commit{}
+	// every filechange is matched by itself, a removed one doesn't make
+	// the following ones removed too
+	var Data_t = []struct {
+		oid      string
+		expected bool
+	}{
+		{target, false},
+		{other, true},
+		{target, false},
+		{other, true},
+	}
+	for _, data := range Data_t {
+		filechange := rewrite.NewFileChange("M", "100644", data.oid, "a.bin")
+		if actual := repo.TweakFileChange(commit, &filechange); actual != data.expected {
+			t.Errorf("test TweakFileChange error: %s expect: %v actual: %v", data.oid, data.expected, actual)
+		}
+	}
+}
+
+func TestLimitWithReplaceText(t *testing.T) {
+	stream := `blob
+mark :1
+original-oid 78981922613b2afb6025042ff6bd878ac1994e85
+data 13
+password=123
+
+blob
+mark :2
+original-oid 4a7c8a1f2c4e1b0a9d5b1b5e7c1b6a2d8f9e0c11
+data 4
+big
+
+reset refs/heads/main
+commit refs/heads/main
+mark :3
+original-oid 0e04e40bdf7cb956b36ed39b3063c253bd0d165c
+author A U Thor <author@example.com> 1633749662 +0800
+committer A U Thor <author@example.com> 1633749662 +0800
+data 6
+first
+M 100644 :1 a.txt
+M 100644 :2 big.bin
+
+done
+`
+	repo := &Repository{
+		context: &Context{
+			opts:           &Options{limit: "3b"},
+			scan_t:         ScanType{filesize: true},
+			branch_changed: mapset.NewSet(),
+			blob_size_list: map[string]string{
+				"78981922613b2afb6025042ff6bd878ac1994e85": "1",
+				"4a7c8a1f2c4e1b0a9d5b1b5e7c1b6a2d8f9e0c11": "4",
+			},
+		},
+		session: rewrite.NewSession(),
+	}
+	// '--replace-text' makes the stream carry the blobs, the file changes
+	// refer to them by marks
+	r := &rewrite.Rewriter{
+		Filter:      repo,
+		WithData:    true,
+		ReplaceText: []*rewrite.ReplaceRule{{Syntax: "literal", Old: []byte("123"), Replacement: []byte("***")}},
+	}
+	var output bytes.Buffer
+	iter := rewrite.NewStreamIter(repo.session, strings.NewReader(stream))
+	if err := r.Filtering(iter, &output); err != nil {
+		t.Fatalf("filtering error: %s", err)
+	}
+	out := output.String()
+	if strings.Contains(out, "big.bin") {
+		t.Errorf("expect big.bin to be removed by --limit, but got:\n%s", out)
+	}
+	if !strings.Contains(out, "password=***") || !strings.Contains(out, "a.txt") {
+		t.Errorf("expect a.txt to be kept and redacted, but got:\n%s", out)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+var ScanFormats = []string{"table", "json", "csv"}
+
+// ScanRecord is a blob of the scan result in JSON
+type ScanRecord struct {
+	Oid         string   `json:"oid"`
+	Size        uint64   `json:"size"`
+	DiskSize    uint64   `json:"disk_size"`
+	Paths       []string `json:"paths"`
+	FirstCommit string   `json:"first_commit"`
+	FirstAuthor string   `json:"first_author"`
+	FirstDate   string   `json:"first_date"` // RFC 3339 in UTC
+	LastCommit  string   `json:"last_commit"`
+	Branches    []string `json:"branches"`
+	Tags        []string `json:"tags"`
+}
+
+func NewScanRecord(item HistoryRecord) ScanRecord {
+	history := BlobHistory{paths: item.paths, commits: item.commits}
+	record := ScanRecord{
+		Oid:         item.oid,
+		Size:        item.objectSize,
+		DiskSize:    item.diskSize,
+		Paths:       item.paths,
+		FirstCommit: history.FirstCommit(),
+		FirstAuthor: item.author,
+		LastCommit:  item.lastCommit,
+		Branches:    item.branches,
+		Tags:        item.tags,
+	}
+	if item.date != 0 {
+		record.FirstDate = time.Unix(item.date, 0).UTC().Format(time.RFC3339)
+	}
+	// [] rather than null
+	if record.Paths == nil {
+		record.Paths = []string{}
+	}
+	if record.Branches == nil {
+		record.Branches = []string{}
+	}
+	if record.Tags == nil {
+		record.Tags = []string{}
+	}
+	return record
+}
+
+// WriteScanResult writes the scan result in the format, one of ScanFormats.
+// In CSV, paths, branches and tags are separated by ';'.
+func WriteScanResult(w io.Writer, list BlobList, format string) error {
+	switch format {
+	case "json":
+		records := make([]ScanRecord, 0, len(list))
+		for _, item := range list {
+			records = append(records, NewScanRecord(item))
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		// keep "name <email>" readable
+		encoder.SetEscapeHTML(false)
+		return encoder.Encode(records)
+	case "csv":
+		writer := csv.NewWriter(w)
+		writer.Write([]string{"oid", "size", "disk_size", "paths", "first_commit", "first_author", "first_date",
+			"last_commit", "branches", "tags"})
+		for _, item := range list {
+			record := NewScanRecord(item)
+			writer.Write([]string{
+				record.Oid,
+				fmt.Sprint(record.Size),
+				fmt.Sprint(record.DiskSize),
+				strings.Join(record.Paths, ";"),
+				record.FirstCommit,
+				record.FirstAuthor,
+				record.FirstDate,
+				record.LastCommit,
+				strings.Join(record.Branches, ";"),
+				strings.Join(record.Tags, ";"),
+			})
+		}
+		writer.Flush()
+		return writer.Error()
+	}
+	WriteScanTable(w, list)
+	return nil
+}
+
+// OutputScanResult writes the scan result into the file of '--output',
+// or shows it on stdout
+func OutputScanResult(ctx *Context, list BlobList) {
+	list.LookupRefs(ctx)
+	if ctx.opts.output == "" {
+		if ctx.opts.format == "table" {
+			ShowScanResult(list)
+			ShowUnreachableResult(ctx.unreachable, ctx.opts.number)
+		} else if err := WriteScanResult(os.Stdout, list, ctx.opts.format); err != nil {
+			ft := LocalPrinter().Sprintf("write scan result error: %s", err)
+			PrintRedln(ft)
+			os.Exit(1)
+		}
+		return
+	}
+
+	f, err := os.Create(ctx.opts.output)
+	if err == nil {
+		err = WriteScanResult(f, list, ctx.opts.format)
+		if err2 := f.Close(); err == nil {
+			err = err2
+		}
+	}
+	if err != nil {
+		ft := LocalPrinter().Sprintf("write scan result error: %s", err)
+		PrintRedln(ft)
+		os.Exit(1)
+	}
+	PrintLocalWithGreenln("scan done!")
+	PrintYellowln(LocalPrinter().Sprintf("scan result is written into: %s", ctx.opts.output))
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestWriteScanResult(t *testing.T) {
+	item := NewHistoryRecord("4fd1482c27853b935c11108688f63e3f4f0f9c80", 1000, 300, &BlobHistory{
+		paths:   []string{"a.zip", "dir/b,c.zip"},
+		commits: []string{"e288c8793273629cf7a0679f4410eaf74c7108f0", "5266b09a8b363e8c50ec25488c821c441c3809a0"},
+		author:  "A U Thor <author@example.com>",
+		date:    1600000000,
+	})
+	item.branches = []string{"main", "dev"}
+	item.tags = []string{"v1"}
+	list := BlobList{item}
+
+	var Data_t = []struct {
+		format   string
+		expected string
+	}{
+		{"csv", "oid,size,disk_size,paths,first_commit,first_author,first_date,last_commit,branches,tags\n" +
+			"4fd1482c27853b935c11108688f63e3f4f0f9c80,1000,300,\"a.zip;dir/b,c.zip\",5266b09a8b363e8c50ec25488c821c441c3809a0," +
+			"A U Thor <author@example.com>,2020-09-13T12:26:40Z,e288c8793273629cf7a0679f4410eaf74c7108f0,main;dev,v1\n"},
+	}
+	for _, data := range Data_t {
+		var out bytes.Buffer
+		if err := WriteScanResult(&out, list, data.format); err != nil {
+			t.Fatalf("test WriteScanResult error: %s", err)
+		}
+		if out.String() != data.expected {
+			t.Errorf("test WriteScanResult error: format %s expect: %q actual: %q", data.format, data.expected, out.String())
+		}
+	}
+
+	var out bytes.Buffer
+	var records []ScanRecord
+	if err := WriteScanResult(&out, list, "json"); err != nil {
+		t.Fatalf("test WriteScanResult error: %s", err)
+	}
+	if err := json.Unmarshal(out.Bytes(), &records); err != nil || len(records) != 1 ||
+		records[0].FirstCommit != "5266b09a8b363e8c50ec25488c821c441c3809a0" || len(records[0].Paths) != 2 {
+		t.Errorf("test WriteScanResult error: unexpected json: %s", out.String())
+	}
+}
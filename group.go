@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+)
+
+var GroupByTypes = []string{"dir", "ext", "path"}
+
+// ScanGroup aggregates all historical versions of the blobs in a path,
+// in a directory, or with a file extension
+type ScanGroup struct {
+	name     string
+	count    int    // number of blobs
+	size     uint64 // total raw size
+	diskSize uint64 // total size in the object database
+	present  bool   // still present at HEAD, or has been deleted
+}
+
+// group_key returns the group of the file path, directories end with '/'
+func group_key(by, file string) string {
+	switch by {
+	case "dir":
+		if dir := path.Dir(file); dir != "." {
+			return dir + "/"
+		}
+		return "/"
+	case "ext":
+		if ext := path.Ext(file); ext != "" {
+			return "*" + ext
+		}
+		return LocalSprintf("no extension")
+	}
+	return file
+}
+
+// GetHeadPaths returns every file path at HEAD, it's empty if there is no HEAD
+func GetHeadPaths(gitbin, workdir string) map[string]bool {
+	paths := make(map[string]bool)
+	out, err := exec.Command(gitbin, "-C", workdir, "ls-tree", "-r", "-z", "--name-only", "HEAD").Output()
+	if err != nil {
+		return paths
+	}
+	for _, file := range strings.Split(string(out), "\x00") {
+		if file != "" {
+			paths[file] = true
+		}
+	}
+	return paths
+}
+
+// GroupBlobs aggregates the blobs by group_key, a blob which has been at
+// several paths of the same group is counted once. The groups are sorted by
+// the total raw size, or the total on-disk size if disk is set.
+func GroupBlobs(list BlobList, by string, head map[string]bool, disk bool) []*ScanGroup {
+	groups := make(map[string]*ScanGroup)
+	for _, item := range list {
+		keys := make(map[string]bool)
+		for _, file := range item.paths {
+			keys[group_key(by, file)] = true
+		}
+		for key := range keys {
+			group, ok := groups[key]
+			if !ok {
+				group = &ScanGroup{name: key}
+				groups[key] = group
+			}
+			group.count++
+			group.size += item.objectSize
+			group.diskSize += item.diskSize
+		}
+	}
+	for file := range head {
+		if group, ok := groups[group_key(by, file)]; ok {
+			group.present = true
+		}
+		// a directory is present if any of its subdirectories is
+		for by == "dir" && file != "." {
+			file = path.Dir(file)
+			if group, ok := groups[file+"/"]; ok {
+				group.present = true
+			}
+		}
+	}
+
+	result := make([]*ScanGroup, 0, len(groups))
+	for _, group := range groups {
+		result = append(result, group)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if disk && result[i].diskSize != result[j].diskSize {
+			return result[i].diskSize > result[j].diskSize
+		}
+		if result[i].size != result[j].size {
+			return result[i].size > result[j].size
+		}
+		return result[i].name < result[j].name
+	})
+	return result
+}
+
+// like ShowScanResult, a Chinese character is 3 bytes, and as wide as 2 letters
+func display_width(s string) int {
+	runes := len([]rune(s))
+	return runes + (len(s)-runes)/2
+}
+
+func ShowGroupResult(groups []*ScanGroup) {
+	PrintLocalWithGreenln("scan done!")
+
+	nameLen, countLen, sizeLen, statusLen := len("Name"), len("COUNT"), len("SIZE"), len("STATUS")
+	status := make([]string, len(groups))
+	for i, group := range groups {
+		if n := display_width(group.name); n > nameLen {
+			nameLen = n
+		}
+		if n := len(fmt.Sprint(group.count)); n > countLen {
+			countLen = n
+		}
+		if n := len(fmt.Sprint(group.size)); n > sizeLen {
+			sizeLen = n
+		}
+		if n := len(fmt.Sprint(group.diskSize)); n > sizeLen {
+			sizeLen = n
+		}
+		if group.present {
+			status[i] = LocalSprintf("present")
+		} else {
+			status[i] = LocalSprintf("deleted")
+		}
+		if n := display_width(status[i]); n > statusLen {
+			statusLen = n
+		}
+	}
+	line := fmt.Sprintf("|-%s-|-%s-|-%s-------|-%s-------|-%s-|\n", strings.Repeat("-", nameLen),
+		strings.Repeat("-", countLen), strings.Repeat("-", sizeLen), strings.Repeat("-", sizeLen), strings.Repeat("-", statusLen))
+	fmt.Println()
+	fmt.Print(line)
+	fmt.Printf("| %-*s | %-*s | %-*s bytes | %-*s bytes | %-*s |\n", nameLen, "Name", countLen, "COUNT", sizeLen, "SIZE", sizeLen, "DISK", statusLen, "STATUS")
+	fmt.Print(line)
+	for i, group := range groups {
+		// pad by the width on the terminal, rather than chars
+		name_pad := nameLen - display_width(group.name) + len([]rune(group.name))
+		status_pad := statusLen - display_width(status[i]) + len([]rune(status[i]))
+		fmt.Printf("| %-*s | %*d | %*d bytes | %*d bytes | %-*s |\n", name_pad, group.name, countLen, group.count,
+			sizeLen, group.size, sizeLen, group.diskSize, status_pad, status[i])
+	}
+	fmt.Print(line)
+	fmt.Println()
+}
+
+// GroupMode scans the repository, and shows the blobs grouped by '--group-by'
+func GroupMode(ctx *Context) {
+	bloblist, err := ScanRepository(ctx)
+	if err != nil {
+		ft := LocalPrinter().Sprintf("scanning repository error: %s", err)
+		PrintRedln(ft)
+		os.Exit(1)
+	}
+	if len(bloblist) == 0 {
+		PrintLocalWithRedln("no files were scanned")
+		os.Exit(1)
+	}
+	head := GetHeadPaths(ctx.gitBin, ctx.workDir)
+	groups := GroupBlobs(bloblist, ctx.opts.groupby, head, ctx.opts.disksize)
+	if len(groups) > int(ctx.opts.number) {
+		groups = groups[:ctx.opts.number]
+	}
+	ShowGroupResult(groups)
+}
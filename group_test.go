@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestGroupBlobs(t *testing.T) {
+	list := BlobList{
+		NewHistoryRecord("4fd1482c27853b935c11108688f63e3f4f0f9c80", 1000, 900, &BlobHistory{paths: []string{"assets/img/a.png"}}),
+		NewHistoryRecord("e288c8793273629cf7a0679f4410eaf74c7108f0", 3000, 100, &BlobHistory{paths: []string{"assets/img/a.png", "assets/img/b.png"}}),
+		NewHistoryRecord("5266b09a8b363e8c50ec25488c821c441c3809a0", 2000, 2000, &BlobHistory{paths: []string{"docs/guide.pdf"}}),
+		NewHistoryRecord("8a2f7e6b1f9d3c1b2e4a5d6c7b8a9f0e1d2c3b4a", 10, 20, &BlobHistory{paths: []string{"README"}}),
+	}
+	head := map[string]bool{"assets/img/b.png": true, "README": true}
+
+	var Data_t = []struct {
+		by       string
+		disk     bool
+		expected []ScanGroup
+	}{
+		{"dir", false, []ScanGroup{
+			{"assets/img/", 2, 4000, 1000, true},
+			{"docs/", 1, 2000, 2000, false},
+			{"/", 1, 10, 20, true},
+		}},
+		{"path", true, []ScanGroup{
+			{"docs/guide.pdf", 1, 2000, 2000, false},
+			{"assets/img/a.png", 2, 4000, 1000, false},
+			{"assets/img/b.png", 1, 3000, 100, true},
+			{"README", 1, 10, 20, true},
+		}},
+		{"ext", false, []ScanGroup{
+			{"*.png", 2, 4000, 1000, true},
+			{"*.pdf", 1, 2000, 2000, false},
+			{LocalSprintf("no extension"), 1, 10, 20, true},
+		}},
+	}
+	for _, data := range Data_t {
+		actual := GroupBlobs(list, data.by, head, data.disk)
+		if len(actual) != len(data.expected) {
+			t.Fatalf("test GroupBlobs error: by %s expect %d groups, actual: %d", data.by, len(data.expected), len(actual))
+		}
+		for i := range actual {
+			if *actual[i] != data.expected[i] {
+				t.Errorf("test GroupBlobs error: by %s expect: %+v actual: %+v", data.by, data.expected[i], *actual[i])
+			}
+		}
+	}
+}
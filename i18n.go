@@ -47,7 +47,7 @@ func initEnglish() {
 	message.SetString(language.English, "introduce GIT LFS",
 		"If you have Gitee LFS(large file storage) service,  you can use '--lfs' option to convert big file into LFS to manage your large file separately.")
 	message.SetString(language.English, "for the use of Gitee LFS, see", "For the use of Gitee LFS, see: ")
-	message.SetString(language.English, "init repo filter error", "Init repo Filter error")
+	message.SetString(language.English, "init repo filter error: %s", "Init repo Filter error: %s")
 	message.SetString(language.English, "ask question module fail: %s", "Ask question module fail: %s")
 	message.SetString(language.English, "before you push to remote, you have to do something below:",
 		"Before you push to remote, you have to do something below:")
@@ -55,31 +55,70 @@ func initEnglish() {
 		"1. install git-lfs by this link: https://packagecloud.io/github/git-lfs/install")
 	message.SetString(language.English, "2. run command: git lfs install",
 		"2. run command: git lfs install")
-	message.SetString(language.English, "3. edit .gitattributes file",
-		`3. run command: git lfs track "your-file"(this will modify .gitattributes file`)
-	message.SetString(language.English, "4. commit your .gitattributes file.",
-		"4. commit your .gitattributes file.")
+	message.SetString(language.English, ".gitattributes has been updated in every rewritten commit to track the LFS files",
+		".gitattributes has been updated in every rewritten commit to track the LFS files, no need to run 'git lfs track'")
 
 	// options.go
 	message.SetString(language.English, "help info", Usage)
 	message.SetString(language.English, "option format error: %s", "Option format error: %s")
 	message.SetString(language.English, "build version: %s", "Build version: %s")
+	message.SetString(language.English, "read paths file error: %s", "Read paths file error: %s")
+	message.SetString(language.English, "read replace text rules error: %s", "Read replace text rules error: %s")
+	message.SetString(language.English, "read message filter error: %s", "Read message filter error: %s")
 	message.SetString(language.English, "single parameter is invalid", "This single parameter is invalid, please combine with other parameter.")
-	message.SetString(language.English, "LFS parameter is invalid", "--lfs parameter must combine with --scan and --type parameter.")
-	// parser.go
-	message.SetString(language.English, "unsupported filechange type", "Unsupported filechange type")
+	message.SetString(language.English, "format parameter is invalid", "--format parameter must be one of 'table', 'json' and 'csv', --format and --output parameters must combine with --scan parameter, and are incompatible with --group-by, --scan-secrets and --interactive.")
+	message.SetString(language.English, "write scan result error: %s", "Write scan result error: %s")
+	message.SetString(language.English, "scan result is written into: %s", "Scan result is written into: %s")
+	message.SetString(language.English, "lfs-export parameter is invalid", "--lfs-export parameter can not combine with --lfs or --interactive parameter.")
+	message.SetString(language.English, "files would be exported from LFS: %d", "Replace %d LFS pointer files(blobs) by their LFS objects:")
+	message.SetString(language.English, "LFS objects missing in %s, their pointers are kept: %d", "LFS objects missing in %s, their pointer files are kept: %d")
+	message.SetString(language.English, "run 'git lfs fetch --all' to download them, then run again", "Run 'git lfs fetch --all' to download them, then run git-repo-clean again.")
+	message.SetString(language.English, "the rewritten history doesn't need the LFS objects in %s any more",
+		"The rewritten history doesn't need the LFS objects in %s any more, you can remove them after pushing, and run 'git lfs uninstall' to remove the LFS hooks.")
+	message.SetString(language.English, "files would be converted into LFS: %d", "%d files will be converted into LFS")
+	message.SetString(language.English, "read LFS pointers error: %s", "Read LFS pointers error: %s")
+	message.SetString(language.English, "LFS objects referenced by branches:", "LFS objects referenced by branches:")
+	message.SetString(language.English, "%d LFS objects, %d missing in %s", "%d LFS objects, %d missing in %s")
+	message.SetString(language.English, "blobs not reachable from the scanned refs: %d", "Blobs not reachable from the scanned refs: %d")
+	message.SetString(language.English, "they are unreachable objects or only on the other branches, and will not be removed", "They are unreachable objects or only on the other branches, and will not be removed")
+	message.SetString(language.English, "group-by parameter is invalid", "--group-by parameter must be one of 'dir', 'ext' and 'path', it must combine with --scan parameter, and is incompatible with --delete, --dry-run, --lfs and --interactive.")
+	message.SetString(language.English, "no extension", "(no extension)")
+	message.SetString(language.English, "present", "present")
+	message.SetString(language.English, "deleted", "deleted")
+	message.SetString(language.English, "refs parameter is invalid", "--refs parameter is incompatible with --branch.")
+	message.SetString(language.English, "refs would be renamed:", "Rename those refs:")
+	message.SetString(language.English, "keep-only parameter is invalid", "--keep-only parameter must combine with --file or --paths-from-file parameter, and is incompatible with --scan.")
+	message.SetString(language.English, "subdirectory-filter parameter is invalid", "--subdirectory-filter parameter is incompatible with --file, --paths-from-file, --keep-only and --scan.")
+	message.SetString(language.English, "scan-secrets parameter is invalid", "--scan-secrets parameter is incompatible with --scan, --file and --lfs, and --secret-rules, --redact-secrets parameter must combine with --scan-secrets parameter.")
+	message.SetString(language.English, "read secret rules error: %s", "Read secret rules error: %s")
+	message.SetString(language.English, "read mailmap error: %s", "Read mailmap error: %s")
+	message.SetString(language.English, "no secrets were found", "No secrets were found.")
+	message.SetString(language.English, "multi select secrets message", "Please select the secrets you want to remove (multiple choices are allowed):")
+	message.SetString(language.English, "no secrets were selected", "You did not select any secret, please select at least one.")
+	message.SetString(language.English, "confirm secrets message", "The above are the secrets you want to remove. Are you sure you want to remove them from the history ?")
+	message.SetString(language.English, "line %d", "line %d")
+	message.SetString(language.English, "first commit: %s, branches: %s", "first commit: %s, branches: %s")
+	message.SetString(language.English, "LFS parameter is invalid", "--lfs parameter must combine with --scan, --file, --limit or --type parameter, and can not combine with --subdirectory-filter.")
+	// filter.go
 	message.SetString(language.English, "nested tags error",
 		"The operation has been aborted because nested tags. It is recommended to use the '--branch=<branch>' option to specify a single branch.")
-	message.SetString(language.English, "no match mark id", "No match mark id")
-	message.SetString(language.English, "no match original-oid", "No match original-oid")
-	message.SetString(language.English, "no match data size", "No match data size")
-	message.SetString(language.English, "failed to write data", "Failed to write data")
 	message.SetString(language.English, "start to clean up specified files",
 		"Start to clean up the specified file from the history (if the repository is too large, the execution time will be long, please wait a few minutes)...")
 	message.SetString(language.English, "start to migrate specified files",
 		"Start converting the specified file to an LFS file (if the repository is too large, the execution time will be long, please wait a few minutes)...")
 
 	message.SetString(language.English, "run git-fast-import process failed", "Run git-fast-import process failed")
+	message.SetString(language.English, "commit-map and ref-map are written into: %s",
+		"The mapping from old commits and refs to the rewritten ones(commit-map, ref-map) are written into: %s")
+	message.SetString(language.English, "dry run done!", "Dry run done! Nothing has been changed, the history rewrite would:")
+	message.SetString(language.English, "nothing would be changed", "Change nothing, please adjust the filter criteria and try again.")
+	message.SetString(language.English, "commits would be dropped: %d", "Drop %d commits:")
+	message.SetString(language.English, "commits would be rewritten: %d", "Rewrite %d commits:")
+	message.SetString(language.English, "filechanges would be removed from %s:", "Remove those files from %s:")
+	message.SetString(language.English, "refs would be skipped:", "Skip those refs:")
+	message.SetString(language.English, "files would be redacted: %d", "Replace text in %d files(blobs):")
+	message.SetString(language.English, "refs would be deleted:", "Delete those refs, no commit is left on them:")
+	message.SetString(language.English, "about %d bytes would be freed", "Free about %d bytes.")
 	// utils.go
 	message.SetString(language.English, "expected a value followed by --limit option, but you are: %s",
 		"Expected a value followed by --limit option, but you are: %s")
@@ -91,7 +130,7 @@ func initEnglish() {
 
 	// repository.go
 	message.SetString(language.English, "start scanning", "Start scanning(if the repository is too large, the scanning time will be long, please wait a few minutes)...")
-	message.SetString(language.English, "run GetBlobName error: %s", "Run GetBlobName error: %s")
+	message.SetString(language.English, "run GetBlobHistory error: %s", "Run GetBlobHistory error: %s")
 	message.SetString(language.English, "run getblobsize error: %s", "Run getblobsize error: %s")
 	message.SetString(language.English, "expected blob object type, but got: %s", "Expected blob object type, but got: %s")
 	message.SetString(language.English, "could not run 'git rev-parse --is-bare-repository': %s", "Could not run 'git rev-parse --is-bare-repository': %s")
@@ -110,7 +149,6 @@ func initEnglish() {
 	message.SetString(language.English, "clone error", "git clone --no-local error")
 	message.SetString(language.English, "run filepach.Abs error", "Run filepach.Abs error")
 	message.SetString(language.English, "bare repo warning", "⚠ Warning: you are in a bare or mirror repo, some operations may be limited.")
-	message.SetString(language.English, "bare repo error", "❌ Error: can't perform any LFS operation in a bare or mirror repo.")
 
 	message.SetString(language.English, "backup done! Backup file path is: %s", "Backup done! Backup file path is: %s")
 	message.SetString(language.English, "push failed",
@@ -152,7 +190,6 @@ func initEnglish() {
 	message.SetString(language.English, "parse uint error: %s", "Parse uint error: %s")
 
 	message.SetString(language.English, "file have been changed", "those files have been converted to LFS file:")
-	message.SetString(language.English, "Convert LFS file error", "Can not convert noraml file into LFS file under non-scan mode")
 
 }
 
@@ -181,7 +218,7 @@ func initChinese() {
 	message.SetString(language.Chinese, "for detailed documentation, see", "    详细文档请参阅: ")
 	message.SetString(language.Chinese, "introduce GIT LFS", "如果开通了Gitee LFS(Large file storage)服务，可使用'--lfs'选项，将大文件迁移到LFS服务器进行管理。")
 	message.SetString(language.Chinese, "for the use of Gitee LFS, see", "Gitee LFS 的使用请参阅：")
-	message.SetString(language.Chinese, "init repo filter error", "初始化仓库过滤器失败")
+	message.SetString(language.Chinese, "init repo filter error: %s", "初始化仓库过滤器失败: %s")
 	message.SetString(language.Chinese, "ask question module fail: %s", "交互式模块运行失败: %s")
 	message.SetString(language.Chinese, "before you push to remote, you have to do something below:",
 		"在你推送仓库到远程之前，必须完成以下操作：")
@@ -189,27 +226,65 @@ func initChinese() {
 		"1. 安装 Git LFS: https://packagecloud.io/github/git-lfs/install")
 	message.SetString(language.Chinese, "2. run command: git lfs install",
 		"2. 在仓库中运行命令：git lfs install ")
-	message.SetString(language.Chinese, "3. edit .gitattributes file",
-		`3. 追踪上述文件(这会修改 .gitattributes 文件)：git lfs track "your-file"`)
-	message.SetString(language.Chinese, "4. commit your .gitattributes file.",
-		"4. 提交修改后的 .gitattributes 文件")
+	message.SetString(language.Chinese, ".gitattributes has been updated in every rewritten commit to track the LFS files",
+		"每个被重写的提交中的 .gitattributes 文件都已添加上述 LFS 文件的追踪规则，无需再运行 'git lfs track'")
 
 	// options.go
 	message.SetString(language.Chinese, "help info", Usage_ZH)
 	message.SetString(language.Chinese, "option format error: %s", "选项格式错误: %s")
 	message.SetString(language.Chinese, "build version: %s", "版本编号: %s")
+	message.SetString(language.Chinese, "read paths file error: %s", "读取路径文件失败: %s")
+	message.SetString(language.Chinese, "read replace text rules error: %s", "读取文本替换规则失败: %s")
+	message.SetString(language.Chinese, "read message filter error: %s", "读取提交信息过滤规则失败: %s")
 	message.SetString(language.Chinese, "single parameter is invalid", "该单项参数无效，请结合其它参数使用")
-	message.SetString(language.Chinese, "LFS parameter is invalid", "--lfs 选项必须结合选项 --scan 和选项 --type 使用")
-	// parser.go
-	message.SetString(language.Chinese, "unsupported filechange type", "不支持的filechange类型")
+	message.SetString(language.Chinese, "format parameter is invalid", "--format 选项只能是 'table'、'json' 或 'csv'，--format 以及 --output 选项必须结合选项 --scan 使用，且与 --group-by、--scan-secrets 以及 --interactive 不兼容")
+	message.SetString(language.Chinese, "write scan result error: %s", "写入扫描结果错误: %s")
+	message.SetString(language.Chinese, "scan result is written into: %s", "扫描结果已写入: %s")
+	message.SetString(language.Chinese, "lfs-export parameter is invalid", "--lfs-export 选项不能与 --lfs 或 --interactive 选项一起使用")
+	message.SetString(language.Chinese, "files would be exported from LFS: %d", "将以下 %d 个LFS指针文件(blob)替换为其LFS对象：")
+	message.SetString(language.Chinese, "LFS objects missing in %s, their pointers are kept: %d", "以下LFS对象不在 %s 中，其指针文件将保持不变: %d")
+	message.SetString(language.Chinese, "run 'git lfs fetch --all' to download them, then run again", "请运行'git lfs fetch --all'下载这些对象，然后再次运行git-repo-clean")
+	message.SetString(language.Chinese, "the rewritten history doesn't need the LFS objects in %s any more",
+		"重写后的历史不再需要 %s 中的LFS对象，推送后可以删除它们，并运行'git lfs uninstall'移除LFS钩子")
+	message.SetString(language.Chinese, "files would be converted into LFS: %d", "将有 %d 个文件被转换为LFS")
+	message.SetString(language.Chinese, "read LFS pointers error: %s", "读取LFS指针文件错误: %s")
+	message.SetString(language.Chinese, "LFS objects referenced by branches:", "各分支引用的LFS对象：")
+	message.SetString(language.Chinese, "%d LFS objects, %d missing in %s", "%d 个LFS对象, 其中 %d 个不在 %s 中")
+	message.SetString(language.Chinese, "blobs not reachable from the scanned refs: %d", "不在所扫描引用中的文件: %d")
+	message.SetString(language.Chinese, "they are unreachable objects or only on the other branches, and will not be removed", "它们是不可达对象或者只存在于其它分支，不会被删除")
+	message.SetString(language.Chinese, "group-by parameter is invalid", "--group-by 选项只能是 'dir'、'ext' 或 'path'，必须结合选项 --scan 使用，且与 --delete、--dry-run、--lfs 以及 --interactive 不兼容")
+	message.SetString(language.Chinese, "no extension", "(无扩展名)")
+	message.SetString(language.Chinese, "present", "存在")
+	message.SetString(language.Chinese, "deleted", "已删除")
+	message.SetString(language.Chinese, "refs parameter is invalid", "--refs 选项与 --branch 不兼容")
+	message.SetString(language.Chinese, "refs would be renamed:", "重命名以下引用：")
+	message.SetString(language.Chinese, "keep-only parameter is invalid", "--keep-only 选项必须结合选项 --file 或 --paths-from-file 使用，且与 --scan 不兼容")
+	message.SetString(language.Chinese, "subdirectory-filter parameter is invalid", "--subdirectory-filter 选项与 --file、--paths-from-file、--keep-only 以及 --scan 不兼容")
+	message.SetString(language.Chinese, "scan-secrets parameter is invalid", "--scan-secrets 选项与 --scan、--file 以及 --lfs 不兼容，--secret-rules、--redact-secrets 选项必须结合选项 --scan-secrets 使用")
+	message.SetString(language.Chinese, "read secret rules error: %s", "读取敏感信息规则失败: %s")
+	message.SetString(language.Chinese, "read mailmap error: %s", "读取mailmap文件失败: %s")
+	message.SetString(language.Chinese, "no secrets were found", "没有发现敏感信息")
+	message.SetString(language.Chinese, "multi select secrets message", "请选择你要清除的敏感信息(可多选):")
+	message.SetString(language.Chinese, "no secrets were selected", "你没有选择任何敏感信息，请至少选择一项。")
+	message.SetString(language.Chinese, "confirm secrets message", "以上是你要清除的敏感信息，确定要从历史中清除吗?")
+	message.SetString(language.Chinese, "line %d", "第 %d 行")
+	message.SetString(language.Chinese, "first commit: %s, branches: %s", "首次提交: %s, 所在分支: %s")
+	message.SetString(language.Chinese, "LFS parameter is invalid", "--lfs 选项必须结合选项 --scan、--file、--limit 或 --type 使用，且不能与 --subdirectory-filter 一起使用")
+	// filter.go
 	message.SetString(language.Chinese, "nested tags error", "处理过程中断，因为仓库中存在嵌套式tag，建议使用'--branch=<branch>'参数指定单个分支。")
-	message.SetString(language.Chinese, "no match mark id", "没有匹配到mark id字段")
-	message.SetString(language.Chinese, "no match original-oid", "没有匹配到original oid字段")
-	message.SetString(language.Chinese, "no match data size", "没有匹配到数据大小字段")
-	message.SetString(language.Chinese, "failed to write data", "写数据失败")
 	message.SetString(language.Chinese, "start to clean up specified files", "开始从历史中清理指定的文件(如果仓库过大，执行时间会比较长，请耐心等待)...")
 	message.SetString(language.Chinese, "start to migrate specified files", "开始将指定的文件转换为LFS文件(如果仓库过大，执行时间会比较长，请耐心等待)...")
 	message.SetString(language.Chinese, "run git-fast-import process failed", "运行git fast-import过程出错")
+	message.SetString(language.Chinese, "commit-map and ref-map are written into: %s", "新旧提交及引用的对应关系(commit-map, ref-map)已写入：%s")
+	message.SetString(language.Chinese, "dry run done!", "试运行完成！仓库没有任何改动，实际重写历史时将会：")
+	message.SetString(language.Chinese, "nothing would be changed", "没有任何改动，请调整筛选条件再试一次。")
+	message.SetString(language.Chinese, "commits would be dropped: %d", "删除 %d 个提交：")
+	message.SetString(language.Chinese, "commits would be rewritten: %d", "重写 %d 个提交：")
+	message.SetString(language.Chinese, "filechanges would be removed from %s:", "从 %s 中删除以下文件：")
+	message.SetString(language.Chinese, "refs would be skipped:", "跳过以下引用：")
+	message.SetString(language.Chinese, "files would be redacted: %d", "替换以下 %d 个文件(blob)中的文本：")
+	message.SetString(language.Chinese, "refs would be deleted:", "删除以下引用，其中已经没有任何提交：")
+	message.SetString(language.Chinese, "about %d bytes would be freed", "大约释放 %d 字节。")
 	// utils.go
 	message.SetString(language.Chinese, "expected a value followed by --limit option, but you are: %s", "'--limit'选项后面需要跟一个数值，但是你给的是: %s")
 	message.SetString(language.Chinese, "expected format: --limit=<n>b|k|m|g, but you are: --limit=%s", "希望的格式为: --limit=<n>b|k|m|g, 但是你给的是: --limit=%s")
@@ -217,7 +292,7 @@ func initChinese() {
 	message.SetString(language.Chinese, "note that there may be multiple versions of the same file", "注意，同一个文件因为版本不同可能会存在多个。")
 	// repository.go
 	message.SetString(language.Chinese, "start scanning", "开始扫描(如果仓库过大，扫描时间会比较长，请耐心等待)...")
-	message.SetString(language.Chinese, "run GetBlobName error: %s", "运行 GetBlobName 错误: %s")
+	message.SetString(language.Chinese, "run GetBlobHistory error: %s", "运行 GetBlobHistory 错误: %s")
 	message.SetString(language.Chinese, "run getblobsize error: %s", "运行 getblobsize 错误: %s")
 	message.SetString(language.Chinese, "expected blob object type, but got: %s", "期望blob类型数据，但实际得到: %s")
 	message.SetString(language.Chinese, "could not run 'git rev-parse --is-bare-repository': %s", "无法运行'git rev-parse --is-bare-repository': %s")
@@ -242,7 +317,6 @@ func initChinese() {
 	message.SetString(language.Chinese, "branches have been changed", "以下分支已经更改：")
 	message.SetString(language.Chinese, "nothing have changed, exit...", "没有文件更改，退出...")
 	message.SetString(language.Chinese, "bare repo warning", "⚠ 警告：您正在裸仓或镜像仓中，有些操作可能会受到限制。")
-	message.SetString(language.Chinese, "bare repo error", "❌ 错误：无法在裸仓或镜像仓中执行LFS相关操作!")
 
 	// cmd.go
 	message.SetString(language.Chinese, "select the type of file to scan, such as zip, png:", "选择要扫描的文件的类型，如：zip, png:")
@@ -273,7 +347,6 @@ func initChinese() {
 	message.SetString(language.Chinese, "parse uint error: %s", "解析无符号整数出错: %s")
 
 	message.SetString(language.Chinese, "file have been changed", "以下这些文件已经被转化为 LFS 文件:")
-	message.SetString(language.Chinese, "Convert LFS file error", "无法在非扫描模式下将文件转换为 LFS 文件")
 
 }
 
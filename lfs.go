@@ -1,113 +1,278 @@
 package main
 
 import (
-	"bytes"
-	"crypto/sha1"
-	"crypto/sha256"
-	"encoding/hex"
 	"fmt"
 	"os"
+	"os/exec"
+	"path"
 	"path/filepath"
-)
+	"sort"
+	"strconv"
+	"strings"
 
-var (
-	LFSVER = "https://git-lfs.github.com/spec/v1"
-	// To protect LFS pointer file itself be converted again
-	LFS_SAFE_SIZE = "200b"
+	"gitee.com/oscstudio/git-repo-clean/rewrite"
 )
 
-type Pointer struct {
-	Version string
-	Oid     string // sha256
-	Size    int64
+// LFSDir returns the directory where LFS objects are stored, see LFSStorageDir()
+func (ctx *Context) LFSDir() string {
+	return ctx.lfsDir
 }
 
-func NewLFSPointer(blob *Blob) Pointer {
-	p := Pointer{
-		Version: LFSVER,
-		Oid:     blob.sha256,
-		Size:    blob.data_size,
+// ReadLFSPointers reads the blobs which have not been read, and records the
+// LFS pointers among them, see Context.lfs_pointers
+func (ctx *Context) ReadLFSPointers(oids []string) error {
+	var unread []string
+	for _, oid := range oids {
+		if _, ok := ctx.lfs_pointers[oid]; !ok {
+			unread = append(unread, oid)
+		}
+	}
+	if len(unread) == 0 {
+		return nil
 	}
-	return p
+	sort.Strings(unread)
+	return CatBlobs(ctx.gitBin, ctx.workDir, unread, func(oid string, data []byte) {
+		// nil if it's not a pointer
+		pointer, _ := rewrite.DecodePointer(data)
+		ctx.lfs_pointers[oid] = pointer
+	})
 }
 
-func GenerateHash(data []byte, alg string) (hash string) {
-	if alg == "sha256sum" {
-		sha256 := sha256.New()
-		sha256.Write(data)
-		return hex.EncodeToString(sha256.Sum(nil))
-	}
-	if alg == "sha1sum" {
-		sha1 := sha1.New()
-		sha1.Write(data)
-		return hex.EncodeToString(sha1.Sum(nil))
-	}
-	return
+// LFSFilterMode selects the blobs to convert into LFS by '--file', '--limit'
+// and '--type' together, across the whole history of the refs to rewrite.
+// A blob is converted wherever it is, if any of its paths is matched.
+func LFSFilterMode(ctx *Context) []string {
+	if ctx.opts.verbose {
+		PrintLocalWithGreenln("start scanning")
+	}
+	var paths rewrite.PathMatcher
+	if ctx.opts.files != nil {
+		matcher, err := rewrite.NewPathMatcher(ctx.opts.files)
+		if err != nil {
+			ft := LocalPrinter().Sprintf("init repo filter error: %s", err)
+			PrintRedln(ft)
+			os.Exit(1)
+		}
+		paths = matcher
+	}
+	limit, err := UnitConvert(ctx.opts.limit)
+	if err != nil {
+		ft := LocalPrinter().Sprintf("convert uint error: %s", err)
+		PrintRedln(ft)
+		os.Exit(1)
+	}
+	revs, err := ctx.ScanRevs()
+	if err != nil {
+		ft := LocalPrinter().Sprintf("scanning repository error: %s", err)
+		PrintRedln(ft)
+		os.Exit(1)
+	}
+	blob_history, err := GetBlobHistory(ctx.gitBin, ctx.workDir, revs)
+	if err != nil {
+		ft := LocalPrinter().Sprintf("run GetBlobHistory error: %s", err)
+		PrintRedln(ft)
+		os.Exit(1)
+	}
+
+	matched := make(map[string][]string) // blob => every path of it
+	var candidates []string
+	for oid, history := range blob_history {
+		if ctx.BlobSize(oid) <= limit {
+			continue
+		}
+		var files []string
+		selected := false
+		for _, file := range history.paths {
+			// the attributes of LFS itself
+			if path.Base(file) == ".gitattributes" {
+				continue
+			}
+			// the blob becomes a pointer at every path, which needs the attributes too
+			files = append(files, file)
+			if ctx.opts.types != DefaultFileType && !MatchFileType([]string{file}, ctx.opts.types) {
+				continue
+			}
+			// with '--keep-only', files not matched are converted instead
+			if paths != nil && paths.Match(file) == ctx.opts.keeponly {
+				continue
+			}
+			selected = true
+		}
+		if selected {
+			matched[oid] = files
+			if size, _ := strconv.Atoi(ctx.blob_size_list[oid]); size < rewrite.LFS_POINTER_MAX_SIZE {
+				candidates = append(candidates, oid)
+			}
+		}
+	}
+	// LFS pointers are already converted
+	if err := ctx.ReadLFSPointers(candidates); err != nil {
+		ft := LocalPrinter().Sprintf("read LFS pointers error: %s", err)
+		PrintRedln(ft)
+		os.Exit(1)
+	}
+	var result []string
+	for oid, files := range matched {
+		if ctx.lfs_pointers[oid] != nil {
+			continue
+		}
+		result = append(result, oid)
+		for _, file := range files {
+			ctx.files_changed.Add(file)
+		}
+	}
+	if len(result) == 0 {
+		PrintLocalWithRedln("no files were scanned")
+		os.Exit(1)
+	}
+	sort.Strings(result)
+	if ctx.opts.verbose {
+		PrintYellowln(LocalPrinter().Sprintf("files would be converted into LFS: %d", len(result)))
+	}
+	return result
 }
 
-// version https://git-lfs.github.com/spec/v1
-// oid sha256:$(sha256)
-// size $(old size)
-func CreatePointerFile(blob *Blob) []byte {
-	var buf bytes.Buffer
-	fmt.Fprintf(&buf, "version %s\n", LFSVER)
-	fmt.Fprintf(&buf, "oid sha256:%s\n", blob.sha256)
-	fmt.Fprintf(&buf, "size %d\n", len(blob.data))
-	if buf.Len() > 200 {
-		fmt.Println("bad LFS Pointer file")
-		return nil
+// LFSPatterns returns the .gitattributes patterns of the converted files:
+// the file types if the files are selected by '--type' only, otherwise
+// every path of the converted blobs. A converted blob may be at the paths
+// of other types as well, they are added one by one.
+func (ctx *Context) LFSPatterns() []string {
+	var patterns []string
+	by_type := !ctx.opts.scan && ctx.opts.files == nil && ctx.opts.types != DefaultFileType
+	if by_type {
+		for _, t := range strings.Split(ctx.opts.types, ",") {
+			if t = strings.TrimPrefix(strings.TrimSpace(t), "."); t != "" {
+				patterns = append(patterns, "*."+t)
+			}
+		}
+	}
+	var files []string
+	for _, file := range ctx.files_changed.ToSlice() {
+		if by_type && MatchFileType([]string{file.(string)}, ctx.opts.types) {
+			continue
+		}
+		files = append(files, rewrite.AttributesPattern(file.(string)))
+	}
+	sort.Strings(files)
+	return append(patterns, files...)
+}
+
+// ShowMissingLFSObjects shows the pointers which are kept by '--lfs-export',
+// since their objects are not in the LFS storage
+func ShowMissingLFSObjects(report *rewrite.Report, lfsdir string) {
+	if len(report.MissingLFSObjects) == 0 {
+		return
+	}
+	PrintYellowln(LocalPrinter().Sprintf("LFS objects missing in %s, their pointers are kept: %d",
+		filepath.Join(lfsdir, "objects"), len(report.MissingLFSObjects)))
+	for _, object := range report.MissingLFSObjects {
+		fmt.Printf("  %s %d bytes (blob %s)\n", object.Pointer.Oid, object.Pointer.Size, object.Blob)
 	}
-	return buf.Bytes()
+	PrintLocalWithYellowln("run 'git lfs fetch --all' to download them, then run again")
+	fmt.Println()
 }
 
-func UpdateBlob(blob *Blob) {
-	pf := CreatePointerFile(blob)
-	newblob := blob
-	newblob.original_oid = GenerateHash(pf, "sha1sum")
-	newblob.data_size = int64(len(pf))
-	newblob.data = pf
+// LFSBranch is how many LFS objects the tip of a branch references
+type LFSBranch struct {
+	name    string
+	objects int // distinct LFS objects
+	missing int // not stored in the local LFS storage
 }
 
-// convert to Git LFS object
-func ConvertToLFSObj(blob *Blob) {
-	f := OpenLFSFile(blob)
-	defer f.Close()
-	n, err := f.Write(blob.data)
+// ScanBranches returns the branches to scan, see ScanRevs()
+func (ctx *Context) ScanBranches() ([]string, error) {
+	revs, err := ctx.ScanRevs()
+	if err != nil {
+		return nil, err
+	}
+	selected := make(map[string]bool)
+	for _, rev := range revs {
+		selected[rev] = true
+	}
+	out, err := exec.Command(ctx.gitBin, "-C", ctx.workDir, "for-each-ref", "--format=%(refname)", "refs/heads").Output()
 	if err != nil {
-		fmt.Printf("write data into %s error: %s", f.Name(), err)
+		return nil, err
 	}
-	if n != int(blob.data_size) {
-		fmt.Println("write error")
+	var branches []string
+	for _, ref := range strings.Fields(string(out)) {
+		name := strings.TrimPrefix(ref, rewrite.BranchPrefix)
+		if selected["--all"] || selected[ref] || selected[name] {
+			branches = append(branches, name)
+		}
 	}
+	return branches, nil
 }
 
-func OpenLFSFile(blob *Blob) (f *os.File) {
-	dir := CreateLFSDir(blob.sha256)
-	file := dir + "/" + blob.sha256
-	f, err := os.Create(file)
+// LFSBranchReport counts the LFS pointers at the tip of every branch to scan,
+// and checks whether their objects exist in the local LFS storage
+func (ctx *Context) LFSBranchReport() ([]LFSBranch, error) {
+	branches, err := ctx.ScanBranches()
 	if err != nil {
-		fmt.Printf("create file error: %s\n", err)
-		return nil
+		return nil, err
+	}
+	// only small blobs may be pointers
+	tips := make([][]string, len(branches))
+	var candidates []string
+	for i, branch := range branches {
+		out, err := exec.Command(ctx.gitBin, "-C", ctx.workDir, "ls-tree", "-r", "-l", "-z", rewrite.BranchPrefix+branch).Output()
+		if err != nil {
+			return nil, err
+		}
+		// "<mode> <type> <oid> <size>\t<path>"
+		for _, entry := range strings.Split(string(out), "\x00") {
+			infos := strings.Fields(entry)
+			if len(infos) < 4 || infos[1] != "blob" {
+				continue
+			}
+			if size, err := strconv.Atoi(infos[3]); err == nil && size < rewrite.LFS_POINTER_MAX_SIZE {
+				tips[i] = append(tips[i], infos[2])
+				candidates = append(candidates, infos[2])
+			}
+		}
+	}
+	if err := ctx.ReadLFSPointers(candidates); err != nil {
+		return nil, err
 	}
-	return f
+
+	var report []LFSBranch
+	for i, branch := range branches {
+		objects := make(map[string]bool)
+		for _, oid := range tips[i] {
+			if pointer := ctx.lfs_pointers[oid]; pointer != nil {
+				objects[pointer.Oid] = true
+			}
+		}
+		result := LFSBranch{name: branch, objects: len(objects)}
+		for oid := range objects {
+			if _, err := os.Stat(rewrite.LFSObjectPath(ctx.LFSDir(), oid)); err != nil {
+				result.missing++
+			}
+		}
+		report = append(report, result)
+	}
+	return report, nil
 }
 
-func CreateLFSDir(sha256 string) (name string) {
-	lfspath := ".git/lfs/objects/" + sha256[0:2] + "/" + sha256[2:4]
-	absdir, err := filepath.Abs(lfspath)
+// ShowLFSReport shows how many LFS objects every branch references,
+// it's skipped if there is no LFS pointer at all
+func ShowLFSReport(ctx *Context) {
+	report, err := ctx.LFSBranchReport()
 	if err != nil {
-		fmt.Println(err)
-		return ""
+		ft := LocalPrinter().Sprintf("read LFS pointers error: %s", err)
+		PrintRedln(ft)
+		return
 	}
-	// if filepath exists, don't create new one
-	_, err = os.Stat(absdir)
-	if err == nil {
-		return absdir
+	total := 0
+	for _, branch := range report {
+		total += branch.objects
 	}
-	err = os.MkdirAll(absdir, 0777)
-	if err != nil {
-		fmt.Printf("create directory error: %s\n", err)
-		return ""
+	if total == 0 {
+		return
+	}
+	PrintLocalWithYellowln("LFS objects referenced by branches:")
+	for _, branch := range report {
+		fmt.Printf("  %s: %s\n", branch.name, LocalPrinter().Sprintf("%d LFS objects, %d missing in %s",
+			branch.objects, branch.missing, filepath.Join(ctx.LFSDir(), "objects")))
 	}
-	return absdir
+	fmt.Println()
 }
@@ -4,25 +4,35 @@ import (
 	"os"
 )
 
-var op Options
-
 func main() {
-	if err := ParseOptions(os.Args[1:]); err != nil {
+	op, err := ParseOptions(os.Args[1:])
+	if err != nil {
 		PrintLocalWithRedln("Parse Option error")
 		os.Exit(1)
 	}
-	var repo = NewRepository()
-	// repo backup
-	BackUp(repo.context.gitBin, repo.context.workDir)
+	var repo = NewRepository(op)
+	// repo backup, a dry run won't change anything
+	if !repo.context.opts.dryrun {
+		BackUp(repo.context.gitBin, repo.context.workDir)
+	}
 
 	// ask for lfs migrate
 	if repo.context.opts.lfs {
 		if ok := AskForMigrateToLFS(); !ok {
+			// the files selected by LFSFilterMode() are only converted,
+			// falling back to deleting them is what scan mode does
+			if !repo.context.opts.scan {
+				PrintLocalWithYellowln("nothing have changed, exit...")
+				os.Exit(1)
+			}
 			repo.context.opts.lfs = false
 		}
 	}
 	// filter data
 	repo.Parser()
+	if repo.context.opts.dryrun {
+		return
+	}
 
 	repo.context.CleanUp()
 	repo.context.Prompt()
@@ -3,8 +3,11 @@ package main
 import (
 	"errors"
 	"os"
+	"strings"
 
 	"github.com/spf13/pflag"
+
+	"gitee.com/oscstudio/git-repo-clean/rewrite"
 )
 
 var BuildVersion string
@@ -28,13 +31,45 @@ Options:
   -p, --path		Git repository path, default is '.'
   -s, --scan		scan the Git repository objects, default to scan all branches
   -f, --file		provie file path directly to delete, incompatible with --scan
+      --paths-from-file	read the '--file' patterns from a file, one per line
+      --keep-only		keep only the files matched by '--file', and remove all the others
+      --subdirectory-filter	keep only the files under the directory, and make it the new root
+      --to-subdirectory	move the whole tree under the directory
+      --path-rename	rename files or directories, like: '--path-rename=old/dir:new/dir'
+      --replace-text	replace text in all files by the rules in a file, such as leaked passwords
+      --scan-secrets	scan the files of the branches for secrets, such as keys, tokens and passwords
+      --secret-rules	read custom secret rules from a file, one regular expression per line
+      --redact-secrets	replace the secrets found by '--scan-secrets', instead of deleting the files
+      --mailmap		rewrite names and emails of authors, committers and taggers by a mailmap file
+      --use-repo-mailmap	rewrite names and emails by the .mailmap file of the repo
+      --replace-message	replace text in commit and tag messages by the rules in a file
+      --strip-trailer	strip the trailer from commit and tag messages, like: '--strip-trailer=Change-Id'
+      --message-filter	rewrite commit and tag messages by a shell command, which reads
+			the message from stdin and prints the new one
   -b, --branch		set the branch where files need to be deleted , default all branches
+      --refs		set the refs to rewrite instead of '--branch', globs are supported and
+			'^' excludes refs, like: '--refs=refs/heads/release/*,^refs/pull/*'
+      --branch-rename	rename branches starting with OLD, like: '--branch-rename=master:main'
+      --tag-rename	rename tags starting with OLD, like: '--tag-rename=v:release-'
   -l, --limit		set the file size limitation, like: '--limit=10m'
+      --disk-size	sort and limit files by the size in the object database, which
+			is compressed or deltified, instead of the raw size
   -n, --number		set the number of results to show
-  -t, --type		set the file name suffix to filter from Git repository
+      --group-by	scan and sum up all the versions of files by 'dir', 'ext' or 'path',
+			then show the largest groups
+      --format		set the format of the scan result: 'table'(default), 'json' or 'csv'
+      --output		write the scan result into a file instead of stdout
+  -t, --type		set the file name suffix to filter from Git repository, several
+			suffixes are separated by ',', like: '--type=psd,tar.gz'
   -i, --interactive 	enable interactive operation
   -d, --delete		execute file cleanup and history rewrite process
   -L, --lfs		migrate big file into Git LFS Pointer file
+      --lfs-export	replace the LFS pointer files in the history by their LFS
+			objects, the reverse of '--lfs'
+      --dry-run		run the whole rewrite process without changing the repo,
+			and report what would be changed
+      --rewrite-msg-oids	replace the commit IDs referenced by commit and tag
+			messages with the rewritten ones
 
 These options can provide users with two ways of using: 
 interactive way, command line way.
@@ -60,10 +95,34 @@ Command-Line way:
   You can limit the number of results by --number option, the default value is 3:
     git repo-clean --scan --limit=100M --type=tar.gz --delete --number=3
 
+  A big text file may be tiny in the pack after delta compression, while a zip
+  file hardly shrinks. The scan shows both sizes, use '--disk-size' to sort
+  and limit files by the size in the object database:
+    git repo-clean --scan --limit=10M --disk-size
+
+  To find out which directories or which types of files bloat the repository,
+  sum up all the versions of the files by directory, extension or path. The
+  report tells whether each of them is still present at HEAD:
+    git repo-clean --scan --group-by=dir --number=10
+
+  The scan result tells where each file comes from: the commit which first
+  added it with its author and date, the last commit which still has it, and
+  the branches and tags containing it. It can be consumed by scripts in JSON
+  or CSV too:
+    git repo-clean --scan --limit=10M --number=100 --format=json --output=scan.json
+
   * If you want to use Git LFS to manage your big file, use '--lfs' option to
-  convert big files into LFS pointer files. Note that this operation must under
-  scan mode, and must specify the file type, and will suppress file number limit:
+  convert big files into LFS pointer files instead of deleting them. The files
+  are selected by '--scan', which suppresses file number limit:
 	git repo-clean --scan --type=so --lfs --delete
+  or by '--file', '--limit' and '--type' together, without scanning, then all
+  the matched files in the whole history are converted in one run:
+	git repo-clean --file='assets/' --type=psd,png --limit=1m --lfs --delete
+  The LFS attributes of the converted files are added into .gitattributes of
+  every rewritten commit, no need to run 'git lfs track' afterwards.
+  Use '--lfs-export' to move the files out of LFS back into the history, the
+  LFS objects must be in the local LFS storage, run 'git lfs fetch --all' first:
+	git repo-clean --lfs-export --delete
 
   * In non-scan mode, which means without specifying the --scan option,
   you can quickly perform the following operations:
@@ -75,12 +134,74 @@ Command-Line way:
     Or, if you want to delete all files under dir/ :
       git repo-clean --file dir/ --delete
 
+    The '--file' option takes gitignore-style patterns by default, a pattern
+    without '/' matches at any level, 'dir/' only matches directories, '**'
+    matches any directories and '!' re-includes paths matched before. Other
+    syntax can be selected by prefix: 'glob:', 'regex:' or 'literal:':
+      git repo-clean --file '*.log' --file '!keep.log' --delete
+      git repo-clean --file 'glob:docs/**/*.png' --delete
+      git repo-clean --file 'regex:^build/.*\.o$' --delete
+
+    A long list of patterns can be read from a file, blank lines and lines
+    starting with '#' are ignored:
+      git repo-clean --paths-from-file paths.txt --delete
+
+    To extract a subset of the history, e.g. split some modules out of a
+    monorepo, use '--keep-only' to keep only the files matched by '--file',
+    commits which become empty are pruned:
+      git repo-clean --file module1/ --file module2/ --keep-only --delete
+
+    To split a subdirectory out as a new repository, or to move the whole
+    repository into a subdirectory before merging it into another one:
+      git repo-clean --subdirectory-filter module1 --delete
+      git repo-clean --to-subdirectory module1 --delete
+
+    Files and directories can also be renamed in the whole history, the rules
+    are applied in order:
+      git repo-clean --path-rename old/dir:new/dir --path-rename a.c:b.c --delete
+
+    If a password has been committed, scrub the text instead of deleting the
+    whole file. Each line of the rules file is 'TEXT' or 'TEXT==>REPLACEMENT',
+    TEXT can be prefixed by 'regex:', 'glob:' or 'literal:', and is replaced
+    by '***REMOVED***' by default:
+      git repo-clean --replace-text rules.txt --delete
+
+    To find out which secrets have been committed, e.g. AWS keys, private keys,
+    JWTs and high-entropy strings, then delete the files or redact the secrets:
+      git repo-clean --scan-secrets
+      git repo-clean --scan-secrets --secret-rules rules.txt --delete
+      git repo-clean --scan-secrets --redact-secrets --delete
+    Add '-i' to select the secrets to delete or redact:
+      git repo-clean --scan-secrets --redact-secrets -i
+
+    To fix names and emails of authors, committers and taggers, e.g. the
+    addresses of ex-employees, use a mailmap file, see git-check-mailmap(1):
+      git repo-clean --mailmap mailmap.txt --delete
+      git repo-clean --use-repo-mailmap --file big.zip --delete
+
+    Commit and tag messages can be rewritten too, by the rules like those of
+    '--replace-text', by stripping trailers, or by a shell command which gets
+    the original commit ID from $GIT_COMMIT:
+      git repo-clean --replace-message rules.txt --strip-trailer Change-Id --delete
+      git repo-clean --message-filter 'sed s/JIRA-/PROJ-/g' --delete
+
+    To rewrite only some refs, list them by '--refs', a ref can be a glob, and
+    a ref starting with '^' is excluded. Branches and tags can be renamed by
+    prefix at the same time, the old refs are deleted after the rewrite:
+      git repo-clean --file big.zip --refs 'refs/heads/release/*' --refs '^refs/pull/*' --delete
+      git repo-clean --branch-rename master:main --tag-rename v:release- --delete
+
     Or, if you want to delete certain type of files in batch：
       git repo-clean --type="png" --delete
 
     Or, delete all files larger than a certain size limit in batch
       git repo-clean --limit=10M --delete
 
+  * Use '--dry-run' instead of '--delete' to preview a rewrite. It reports which
+  commits would be dropped or rewritten, which files would be removed from each
+  branch, which refs would be skipped and how many bytes would be freed:
+    git repo-clean --file dir/ --dry-run
+
 
 `
 const Usage_ZH = `用法: git repo-clean [选项]
@@ -101,13 +222,40 @@ git repo-clean 是一款扫描Git仓库元数据，然后根据指定的文件
   -p, --path		指定Git仓库的路径, 默认是当前目录，即'.'
   -s, --scan		扫描Git仓库数据，默认是扫描所有分支中的数据
   -f, --file		直接指定仓库中的文件或目录，与'--scan'不兼容
+      --paths-from-file	从文件中读取'--file'的匹配模式，每行一个
+      --keep-only		只保留'--file'匹配到的文件，删除其它所有文件
+      --subdirectory-filter	只保留指定目录中的文件，并将该目录作为新的根目录
+      --to-subdirectory	将整个仓库的文件移动到指定目录下
+      --path-rename	重命名文件或目录, 比如: '--path-rename=old/dir:new/dir'
+      --replace-text	根据文件中的规则替换所有文件中的文本，比如泄露的密码
+      --scan-secrets	扫描分支中所有文件的密钥、令牌、密码等敏感信息
+      --secret-rules	从文件中读取自定义的敏感信息规则，每行一个正则表达式
+      --redact-secrets	替换'--scan-secrets'扫描出的敏感信息，而不是删除整个文件
+      --mailmap		根据mailmap文件重写作者、提交者以及tag创建者的名字和邮箱
+      --use-repo-mailmap	根据仓库中的.mailmap文件重写名字和邮箱
+      --replace-message	根据文件中的规则替换提交信息以及tag信息中的文本
+      --strip-trailer	删除提交信息以及tag信息中的trailer, 比如: '--strip-trailer=Change-Id'
+      --message-filter	使用shell命令重写提交信息以及tag信息，命令从标准输入读取原信息，
+			并输出新的信息
   -b, --branch		设置需要删除文件的分支, 默认是从所有分支中删除文件
+      --refs		代替'--branch'设置需要重写的引用，支持通配符，'^'表示排除,
+			比如: '--refs=refs/heads/release/*,^refs/pull/*'
+      --branch-rename	重命名以OLD开头的分支, 比如: '--branch-rename=master:main'
+      --tag-rename	重命名以OLD开头的tag, 比如: '--tag-rename=v:release-'
   -l, --limit		设置扫描文件阈值, 比如: '--limit=10m'
+      --disk-size	按照文件在对象数据库中(压缩或增量存储后)的大小排序以及过滤，而不是原始大小
   -n, --number		设置显示扫描结果的数量
-  -t, --type		设置扫描文件后缀名，即文件类型
+      --group-by	扫描并按照'dir'(目录)、'ext'(扩展名)或'path'(路径)汇总文件的所有版本，
+			然后显示最大的几组
+      --format		设置扫描结果的格式: 'table'(默认)、'json'或'csv'
+      --output		将扫描结果写入文件，而不是输出到标准输出
+  -t, --type		设置扫描文件后缀名，即文件类型，多个后缀名以','分隔，比如: '--type=psd,tar.gz'
   -i, --interactive 	开启交互式操作
   -d, --delete		执行文件删除和历史重写过程
   -L, --lfs		将大文件转换为Git LFS指针文件
+      --lfs-export	将历史中的LFS指针文件替换为其LFS对象的内容，即'--lfs'的逆操作
+      --dry-run		试运行整个重写过程，但不修改仓库，只报告将会发生的改动
+      --rewrite-msg-oids	将提交信息及tag信息中引用的提交ID替换为重写后的ID
 
 
 这些选项主要可以给用户提供两种使用方法：交互式、命令行式
@@ -133,11 +281,26 @@ git repo-clean 是一款扫描Git仓库元数据，然后根据指定的文件
   可以通过--number选项，控制扫描结果的数量，默认只扫描出前3个最大文件：
     git repo-clean --scan --limit=1G --type=tar.gz --delete --number=3
 
+  大的文本文件经过增量压缩之后，在包中可能很小，而zip文件则几乎无法压缩。扫描结果会同时
+  显示两种大小，使用'--disk-size'可以按照文件在对象数据库中的大小排序以及过滤：
+    git repo-clean --scan --limit=10M --disk-size
 
-  * 如果你想用Git LFS管理大文件，可以使用'--lfs'选项将大文件转换为LFS指针文件
-  这个操作必须在扫描模式下进行，必须指定文件类型，即必须有--scan, --type 参数
-  此时--number参数无效：
+  如果想知道是哪些目录或者哪些类型的文件占用了仓库空间，可以按照目录、扩展名或者路径汇总文件
+  的所有版本，结果中还会显示它们在HEAD中是否仍然存在：
+    git repo-clean --scan --group-by=dir --number=10
+
+  扫描结果会显示每个文件的来源：首次添加它的提交及其作者和日期、最后一个仍包含它的提交，
+  以及包含它的分支和tag。扫描结果也可以输出为JSON或CSV格式，以便脚本处理：
+    git repo-clean --scan --limit=10M --number=100 --format=json --output=scan.json
+
+  * 如果你想用Git LFS管理大文件，可以使用'--lfs'选项将大文件转换为LFS指针文件，而不是删除它们
+  可以通过扫描选择文件，此时--number参数无效：
     git repo-clean --scan --type=so --lfs --delete
+  也可以不扫描，同时使用'--file'、'--limit'和'--type'选择文件，一次转换整个历史中匹配的文件：
+    git repo-clean --file='assets/' --type=psd,png --limit=1m --lfs --delete
+  被转换文件的LFS属性会自动添加到每个被重写提交的.gitattributes文件中，之后无需再运行'git lfs track'
+  使用'--lfs-export'可以将文件从LFS中移回历史，LFS对象必须已在本地，请先运行'git lfs fetch --all'：
+    git repo-clean --lfs-export --delete
 
 
   * 在非扫描模式下，即不指定 --scan 参数，可以快速进行以下操作：
@@ -148,28 +311,104 @@ git repo-clean 是一款扫描Git仓库元数据，然后根据指定的文件
     或者，批量删除某个目录下所有的文件：
       git repo-clean --file dir/ --delete
 
+    '--file'选项默认使用gitignore风格的匹配模式，不含'/'的模式可以匹配任意层级，
+    'dir/'只匹配目录，'**'匹配任意层目录，'!'重新包含前面的模式匹配到的路径。
+    也可以通过前缀选择其它语法：'glob:'、'regex:'或'literal:'：
+      git repo-clean --file '*.log' --file '!keep.log' --delete
+      git repo-clean --file 'glob:docs/**/*.png' --delete
+      git repo-clean --file 'regex:^build/.*\.o$' --delete
+
+    匹配模式较多时可以从文件中读取，空行以及以'#'开头的行会被忽略：
+      git repo-clean --paths-from-file paths.txt --delete
+
+    如果需要提取部分历史，比如从大仓中拆分出某些模块，可以使用'--keep-only'选项，
+    只保留'--file'匹配到的文件，变为空的提交会被删除：
+      git repo-clean --file module1/ --file module2/ --keep-only --delete
+
+    将某个子目录拆分为一个新的仓库，或者在合并到其它仓库之前，将整个仓库移动到某个子目录下：
+      git repo-clean --subdirectory-filter module1 --delete
+      git repo-clean --to-subdirectory module1 --delete
+
+    也可以在整个历史中重命名文件或目录，多个规则按顺序生效：
+      git repo-clean --path-rename old/dir:new/dir --path-rename a.c:b.c --delete
+
+    如果提交了密码，可以只替换掉密码文本，而不必删除整个文件。规则文件的每一行为
+    '文本'或者'文本==>替换文本'，文本可以使用'regex:'、'glob:'或'literal:'前缀，
+    默认替换为'***REMOVED***'：
+      git repo-clean --replace-text rules.txt --delete
+
+    扫描历史中提交过的敏感信息，比如AWS密钥、私钥、JWT以及高熵字符串，然后删除这些文件，或者替换掉敏感信息：
+      git repo-clean --scan-secrets
+      git repo-clean --scan-secrets --secret-rules rules.txt --delete
+      git repo-clean --scan-secrets --redact-secrets --delete
+    加上'-i'可以选择要删除或替换的敏感信息：
+      git repo-clean --scan-secrets --redact-secrets -i
+
+    修正作者、提交者以及tag创建者的名字和邮箱，比如已离职员工的邮箱，可以使用mailmap文件，
+    格式见git-check-mailmap(1)：
+      git repo-clean --mailmap mailmap.txt --delete
+      git repo-clean --use-repo-mailmap --file big.zip --delete
+
+    也可以重写提交信息以及tag信息，可以使用与'--replace-text'相同格式的规则，删除trailer，
+    或者使用shell命令(原提交ID可以通过$GIT_COMMIT获取)：
+      git repo-clean --replace-message rules.txt --strip-trailer Change-Id --delete
+      git repo-clean --message-filter 'sed s/JIRA-/PROJ-/g' --delete
+
+    如果只需要重写部分引用，可以使用'--refs'指定，支持通配符，以'^'开头的引用会被排除。
+    同时还可以按前缀重命名分支和tag，旧的引用会在重写之后被删除：
+      git repo-clean --file big.zip --refs 'refs/heads/release/*' --refs '^refs/pull/*' --delete
+      git repo-clean --branch-rename master:main --tag-rename v:release- --delete
+
     又或者，批量删除某种类型文件：
       git repo-clean --type="png" --delete
 
     再或者，批量删除超过某个大小的所有文件：
       git repo-clean --limit=10M --delete
 
+  * 使用'--dry-run'代替'--delete'可以预览重写结果，它会报告哪些提交将被删除或重写，
+  每个分支中哪些文件将被删除，哪些引用将被跳过，以及大约可以释放多少空间：
+    git repo-clean --file dir/ --dry-run
+
 `
 
 type Options struct {
-	verbose  bool
-	version  bool
-	help     bool
-	path     string
-	scan     bool
-	files    []string
-	delete   bool
-	branch   string
-	limit    string
-	number   uint32
-	types    string
-	interact bool
-	lfs      bool
+	verbose     bool
+	version     bool
+	help        bool
+	path        string
+	scan        bool
+	files       []string
+	pathfile    string
+	keeponly    bool
+	subdir      string
+	tosubdir    string
+	renames     []string
+	replace     string
+	secrets     bool
+	secretrules string
+	redact      bool
+	mailmap     string
+	repomailmap bool
+	msgrules    string
+	trailers    []string
+	msgfilter   string
+	delete      bool
+	branch      string
+	refs        []string
+	branchrules []string
+	tagrules    []string
+	limit       string
+	disksize    bool
+	number      uint32
+	groupby     string
+	format      string
+	output      string
+	types       string
+	interact    bool
+	lfs         bool
+	lfsexport   bool
+	dryrun      bool
+	msgoids     bool
 }
 
 var UserInput []string
@@ -185,7 +424,8 @@ var (
 	DefaultRepoScan   = false
 )
 
-func initialize(args []string) error {
+func initialize(args []string) (*Options, error) {
+	op := &Options{}
 
 	flags := pflag.NewFlagSet("git-repo-clean", pflag.ContinueOnError)
 
@@ -198,12 +438,44 @@ func initialize(args []string) error {
 	flags.BoolVarP(&op.scan, "scan", "s", DefaultRepoScan, "scan the Git repository objects")
 	// specify the target files to delete
 	flags.StringArrayVarP(&op.files, "file", "f", DefaultFileInput, "specify the target files to delete")
+	// same as '--file', but read patterns from a file
+	flags.StringVar(&op.pathfile, "paths-from-file", "", "read the target file patterns from a file")
+	// invert the '--file' patterns
+	flags.BoolVar(&op.keeponly, "keep-only", false, "keep only the files matched by '--file', and remove all the others")
+	// relocate paths, see PathRenames()
+	flags.StringVar(&op.subdir, "subdirectory-filter", "", "keep only the files under the directory, and make it the new root")
+	flags.StringVar(&op.tosubdir, "to-subdirectory", "", "move the whole tree under the directory")
+	flags.StringArrayVar(&op.renames, "path-rename", nil, "rename files or directories, like: 'old/dir:new/dir'")
+	// redact blob data, see rewrite.ReplaceRule
+	flags.StringVar(&op.replace, "replace-text", "", "replace text in all files by the rules in a file")
+	// scan secrets, then delete the files or redact the secrets
+	flags.BoolVar(&op.secrets, "scan-secrets", false, "scan all files for secrets")
+	flags.StringVar(&op.secretrules, "secret-rules", "", "read custom secret rules from a file")
+	flags.BoolVar(&op.redact, "redact-secrets", false, "replace the secrets instead of deleting the files")
+	// rewrite identities
+	flags.StringVar(&op.mailmap, "mailmap", "", "rewrite names and emails by a mailmap file")
+	flags.BoolVar(&op.repomailmap, "use-repo-mailmap", false, "rewrite names and emails by the .mailmap file of the repo")
+	// rewrite messages, see rewrite.MessageFilter
+	flags.StringVar(&op.msgrules, "replace-message", "", "replace text in commit and tag messages by the rules in a file")
+	flags.StringArrayVar(&op.trailers, "strip-trailer", nil, "strip the trailer from commit and tag messages")
+	flags.StringVar(&op.msgfilter, "message-filter", "", "rewrite commit and tag messages by a shell command")
 	// since the deleting process is not very slow, default is all branch
 	flags.StringVarP(&op.branch, "branch", "b", DefaultRepoBranch, "set the branch to scan")
+	// select and rename refs, see RefRenames()
+	flags.StringSliceVar(&op.refs, "refs", nil, "set the refs to rewrite instead of '--branch'")
+	flags.StringArrayVar(&op.branchrules, "branch-rename", nil, "rename branches starting with OLD, like: 'master:main'")
+	flags.StringArrayVar(&op.tagrules, "tag-rename", nil, "rename tags starting with OLD, like: 'v:release-'")
 	// default file size threshold is 1m
 	flags.StringVarP(&op.limit, "limit", "l", DefaultFileSize, "set the file size limitation")
+	// e.g. delta compressed text files are tiny on disk
+	flags.BoolVar(&op.disksize, "disk-size", false, "sort and limit files by the size in the object database")
 	// default to show top 3 largest files
 	flags.Uint32VarP(&op.number, "number", "n", DefaultFileNumber, "set the number of results to show")
+	// aggregate the scan result, see GroupBlobs()
+	flags.StringVar(&op.groupby, "group-by", "", "sum up all the versions of files by 'dir', 'ext' or 'path'")
+	// machine-readable scan result, see WriteScanResult()
+	flags.StringVar(&op.format, "format", "table", "set the format of the scan result: 'table', 'json' or 'csv'")
+	flags.StringVar(&op.output, "output", "", "write the scan result into a file")
 	// default is null, which means all types
 	flags.StringVarP(&op.types, "type", "t", DefaultFileType, "set the file type to filter from Git repository")
 	// interactive with user end
@@ -213,26 +485,33 @@ func initialize(args []string) error {
 
 	// migrate big file into Git LFS server
 	flags.BoolVarP(&op.lfs, "lfs", "L", false, "migrate big file into Git LFS server")
+	// the reverse of '--lfs', see rewrite.LFSExporter
+	flags.BoolVar(&op.lfsexport, "lfs-export", false, "replace LFS pointer files by their LFS objects")
+	// run the rewrite process, but discard its result
+	flags.BoolVar(&op.dryrun, "dry-run", false, "report what would be changed by the history rewrite process")
+	// e.g. "Reverts abc1234" in commit message
+	flags.BoolVar(&op.msgoids, "rewrite-msg-oids", false, "replace commit IDs in commit and tag messages with the rewritten ones")
 
 	err := flags.Parse(args)
 	if err != nil {
 		if err == pflag.ErrHelp {
-			return nil
+			return op, nil
 		}
-		return err
+		return nil, err
 	}
 	if len(flags.Args()) != 0 {
-		return errors.New("excess arguments")
+		return nil, errors.New("excess arguments")
 	}
-	return nil
+	return op, nil
 }
 
 func usage() {
 	LocalFprintf(os.Stderr, "help info")
 }
 
-func ParseOptions(args []string) error {
-	if err := initialize(args); err != nil {
+func ParseOptions(args []string) (*Options, error) {
+	op, err := initialize(args)
+	if err != nil {
 		ft := LocalPrinter().Sprintf("option format error: %s", err)
 		PrintRedln(ft)
 		os.Exit(1)
@@ -249,35 +528,209 @@ func ParseOptions(args []string) error {
 	if len(args) == 0 {
 		op.interact = true
 	}
-	if len(args) == 1 && SingleOpts() {
+	if op.pathfile != "" {
+		patterns, err := rewrite.ReadPatternFile(op.pathfile)
+		if err != nil {
+			ft := LocalPrinter().Sprintf("read paths file error: %s", err)
+			PrintRedln(ft)
+			os.Exit(1)
+		}
+		op.files = append(op.files, patterns...)
+	}
+	// '--subdirectory-filter' keeps only the directory, and promotes it
+	if op.subdir != "" {
+		if op.files != nil || op.keeponly || op.scan {
+			PrintLocalWithRedln("subdirectory-filter parameter is invalid")
+			os.Exit(1)
+		}
+		op.files = []string{"literal:" + op.subdir}
+		op.keeponly = true
+	}
+	if _, err := op.PathRenames(); err != nil {
+		ft := LocalPrinter().Sprintf("option format error: %s", err)
+		PrintRedln(ft)
+		os.Exit(1)
+	}
+	if _, err := op.RefRenames(); err != nil {
+		ft := LocalPrinter().Sprintf("option format error: %s", err)
+		PrintRedln(ft)
+		os.Exit(1)
+	}
+	if op.refs != nil && op.branch != DefaultRepoBranch {
+		PrintLocalWithRedln("refs parameter is invalid")
+		os.Exit(1)
+	}
+	if _, err := op.ReplaceRules(); err != nil {
+		ft := LocalPrinter().Sprintf("read replace text rules error: %s", err)
+		PrintRedln(ft)
+		os.Exit(1)
+	}
+	if op.mailmap != "" {
+		if _, err := rewrite.ReadMailmap(op.mailmap); err != nil {
+			ft := LocalPrinter().Sprintf("read mailmap error: %s", err)
+			PrintRedln(ft)
+			os.Exit(1)
+		}
+	}
+	if _, err := op.MessageFilter(); err != nil {
+		ft := LocalPrinter().Sprintf("read message filter error: %s", err)
+		PrintRedln(ft)
+		os.Exit(1)
+	}
+	if (op.secrets && (op.scan || op.files != nil || op.lfs)) || (!op.secrets && (op.redact || op.secretrules != "")) {
+		PrintLocalWithRedln("scan-secrets parameter is invalid")
+		os.Exit(1)
+	}
+	if op.keeponly && (op.files == nil || op.scan) {
+		PrintLocalWithRedln("keep-only parameter is invalid")
+		os.Exit(1)
+	}
+	if op.groupby != "" && !op.ValidateGroupOpts() {
+		PrintLocalWithRedln("group-by parameter is invalid")
+		os.Exit(1)
+	}
+	if !op.ValidateFormatOpts() {
+		PrintLocalWithRedln("format parameter is invalid")
+		os.Exit(1)
+	}
+	if len(args) == 1 && op.SingleOpts() {
 		PrintLocalWithRedln("single parameter is invalid")
 		os.Exit(1)
 	}
 
-	// '--lfs' option must follow with '--scan' and '--types'
-	if !ValidateLFSOpts() {
+	// '--lfs' option must follow with a filter
+	if !op.ValidateLFSOpts() {
 		PrintLocalWithRedln("LFS parameter is invalid")
 		os.Exit(1)
 	}
+	// '--interactive' migrates files into LFS
+	if op.lfsexport && (op.lfs || op.interact) {
+		PrintLocalWithRedln("lfs-export parameter is invalid")
+		os.Exit(1)
+	}
 
-	return nil
+	return op, nil
 }
 
-func SingleOpts() bool {
-	if !op.interact && (op.verbose || op.scan || op.delete || op.path != "") {
+func (op *Options) SingleOpts() bool {
+	if !op.interact && (op.verbose || op.scan || op.delete || op.dryrun || op.path != "") {
 		return true
 	} else {
 		return false
 	}
 }
 
-func ValidateLFSOpts() bool {
-	if op.lfs {
-		if op.scan != DefaultRepoScan && op.types != DefaultFileType {
+// '--group-by' only reports the scan result, it deletes nothing
+func (op *Options) ValidateGroupOpts() bool {
+	if !op.scan || op.delete || op.dryrun || op.lfs || op.interact {
+		return false
+	}
+	for _, by := range GroupByTypes {
+		if op.groupby == by {
 			return true
-		} else {
+		}
+	}
+	return false
+}
+
+// '--format' and '--output' only apply to the result of '--scan'
+func (op *Options) ValidateFormatOpts() bool {
+	if op.format == "table" && op.output == "" {
+		return true
+	}
+	if !op.scan || op.groupby != "" || op.interact || op.secrets {
+		return false
+	}
+	for _, format := range ScanFormats {
+		if op.format == format {
+			return true
+		}
+	}
+	return false
+}
+
+// ScanToStdout reports whether the scan result in JSON or CSV is written
+// into stdout, so that the other messages should be suppressed
+func (op *Options) ScanToStdout() bool {
+	return op.format != "table" && op.output == ""
+}
+
+// '--lfs' converts the files selected by '--scan', or by any of '--file',
+// '--limit' and '--type', instead of deleting them
+func (op *Options) ValidateLFSOpts() bool {
+	if op.lfs {
+		// it drops all the other files
+		if op.subdir != "" {
 			return false
 		}
+		return op.scan || op.files != nil || op.limit != DefaultFileSize || op.types != DefaultFileType
 	}
 	return true
 }
+
+// PathRenames returns the rename rules in order:
+// '--path-rename', '--subdirectory-filter', then '--to-subdirectory'
+func (op *Options) PathRenames() ([]rewrite.PathRename, error) {
+	var renames []rewrite.PathRename
+	for _, rule := range op.renames {
+		rename, err := rewrite.ParsePathRename(rule)
+		if err != nil {
+			return nil, err
+		}
+		renames = append(renames, rename)
+	}
+	if op.subdir != "" {
+		renames = append(renames, rewrite.PathRename{Old: strings.Trim(op.subdir, "/")})
+	}
+	if op.tosubdir != "" {
+		renames = append(renames, rewrite.PathRename{New: strings.Trim(op.tosubdir, "/")})
+	}
+	return renames, nil
+}
+
+// RefRenames returns the rename rules of '--branch-rename', then '--tag-rename'
+func (op *Options) RefRenames() ([]rewrite.RefRename, error) {
+	var renames []rewrite.RefRename
+	for _, rule := range op.branchrules {
+		rename, err := rewrite.ParseRefRename(rewrite.BranchPrefix, rule)
+		if err != nil {
+			return nil, err
+		}
+		renames = append(renames, rename)
+	}
+	for _, rule := range op.tagrules {
+		rename, err := rewrite.ParseRefRename(rewrite.TagPrefix, rule)
+		if err != nil {
+			return nil, err
+		}
+		renames = append(renames, rename)
+	}
+	return renames, nil
+}
+
+// ReplaceRules returns the rules of '--replace-text', nil if not set
+func (op *Options) ReplaceRules() ([]*rewrite.ReplaceRule, error) {
+	if op.replace == "" {
+		return nil, nil
+	}
+	return rewrite.ReadReplaceRules(op.replace)
+}
+
+// MessageFilter returns the message filter, nil if no option is set
+func (op *Options) MessageFilter() (*rewrite.MessageFilter, error) {
+	if op.msgrules == "" && len(op.trailers) == 0 && op.msgfilter == "" {
+		return nil, nil
+	}
+	filter := &rewrite.MessageFilter{
+		Trailers: op.trailers,
+		Command:  op.msgfilter,
+	}
+	if op.msgrules != "" {
+		rules, err := rewrite.ReadReplaceRules(op.msgrules)
+		if err != nil {
+			return nil, err
+		}
+		filter.Rules = rules
+	}
+	return filter, nil
+}
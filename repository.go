@@ -16,21 +16,29 @@ import (
 	"path/filepath"
 
 	mapset "github.com/deckarep/golang-set"
-)
 
-var (
-	Branch_changed = mapset.NewSet()         // record branches that has been changed
-	Files_changed  = mapset.NewSet()         // record files for LFS
-	Blob_size_list = make(map[string]string) // record repo's blob list
+	"gitee.com/oscstudio/git-repo-clean/rewrite"
 )
 
 type Context struct {
 	workDir string
 	gitBin  string
 	gitDir  string
+	lfsDir  string // where LFS objects are stored, see LFSStorageDir()
 	bare    bool
 	opts    *Options
 	scan_t  ScanType
+	paths   rewrite.PathMatcher // match the files provided by '--file'
+
+	branch_changed mapset.Set             // record branches that has been changed
+	files_changed  mapset.Set             // record files for LFS
+	blob_size_list map[string]string      // record repo's blob list
+	blob_disk_size map[string]string      // blob => size in the object database, compressed or deltified
+	redactions     []*rewrite.ReplaceRule // replace the secrets found by '--scan-secrets'
+	unreachable    BlobList               // blobs above the limit which are not reachable from the scanned refs
+
+	// blob => LFS pointer of the blobs read by ReadLFSPointers(), nil if not a pointer
+	lfs_pointers map[string]*rewrite.Pointer
 }
 
 type ScanType struct {
@@ -41,18 +49,28 @@ type ScanType struct {
 
 type Repository struct {
 	context  *Context
+	session  *rewrite.Session // state of the history rewrite
 	filtered []string
 }
 
 type HistoryRecord struct {
 	oid        string
 	objectSize uint64
-	objectName string
+	diskSize   uint64   // size in the object database, compressed or deltified
+	objectName string   // every path of the blob, separated by ", "
+	paths      []string // every path the blob has been at
+	commits    []string // commits which added the blob, the latest first
+	author     string   // author of the first commit, "name <email>"
+	date       int64    // author date of the first commit
+	lastCommit string   // the latest commit which still has the blob, see LookupRefs()
+	removal    *BlobRemoval
+	branches   []string // branches containing the blob, see LookupRefs()
+	tags       []string // tags containing the blob, see LookupRefs()
 }
 
 type BlobList []HistoryRecord
 
-func InitContext(path string) (*Context, error) {
+func InitContext(path string, op *Options) (*Context, error) {
 	// Find the `git` executable to be used:
 	gitBin, err := findGitBin()
 	if err != nil {
@@ -75,7 +93,9 @@ func InitContext(path string) (*Context, error) {
 	var bare bool
 	if b, err := IsBare(gitBin, path); b && err == nil {
 		bare = true
-		PrintLocalWithYellowln("bare repo warning")
+		if !op.ScanToStdout() {
+			PrintLocalWithYellowln("bare repo warning")
+		}
 	}
 
 	// check if current repo has uncommited files
@@ -97,24 +117,36 @@ func InitContext(path string) (*Context, error) {
 		return nil, err
 	}
 
+	lfsdir, err := LFSStorageDir(gitBin, path)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Context{
 		workDir: path,   // worktree dir
 		gitDir:  gitdir, // .git dir
+		lfsDir:  lfsdir, // .git/lfs dir
 		gitBin:  gitBin,
 		bare:    bare,
-		opts:    &op, // global
+		opts:    op,
+
+		branch_changed: mapset.NewSet(),
+		files_changed:  mapset.NewSet(),
+		blob_size_list: make(map[string]string),
+		blob_disk_size: make(map[string]string),
+		lfs_pointers:   make(map[string]*rewrite.Pointer),
 	}, nil
 }
 
-func NewRepository() *Repository {
+func NewRepository(op *Options) *Repository {
 	// init repo context
-	ctx, err := InitContext(op.path)
+	ctx, err := InitContext(op.path, op)
 	if err != nil {
 		PrintLocalWithRedln(LocalPrinter().Sprintf("%s", err))
 		os.Exit(1)
 	}
 	// important! get repo blob list
-	err = GetBlobSize(ctx.gitBin, ctx.workDir)
+	ctx.blob_size_list, ctx.blob_disk_size, err = GetBlobSize(ctx.gitBin, ctx.workDir)
 	if err != nil {
 		ft := LocalPrinter().Sprintf("run getblobsize error: %s", err)
 		PrintRedln(ft)
@@ -122,50 +154,222 @@ func NewRepository() *Repository {
 	// scan repo files
 	scanedfiles, err := ScanFiles(ctx)
 	if err != nil {
-		LocalFprintf(os.Stderr, "init repo filter error")
+		ft := LocalPrinter().Sprintf("init repo filter error: %s", err)
+		PrintRedln(ft)
 		os.Exit(1)
 	}
 
 	return &Repository{
 		context:  ctx,
+		session:  rewrite.NewSession(),
 		filtered: scanedfiles,
 	}
 }
 
-func GetBlobName(gitbin, path, oid string) (string, error) {
-	cmd := exec.Command(gitbin, "-C", path, "rev-list", "--objects", "--all")
+// BlobHistory is where and when a blob has been in the history
+type BlobHistory struct {
+	paths   []string // every path the blob has been at, sorted
+	commits []string // commits which added the blob at any path, the latest first
+	author  string   // author of the first commit, "name <email>"
+	date    int64    // author date of the first commit
+	removal *BlobRemoval
+}
+
+// BlobRemoval is the latest commit which removed or replaced the blob,
+// its parent at the path is the last commit having the blob there
+type BlobRemoval struct {
+	commit  string
+	parents []string
+	path    string
+	date    int64 // committer date
+}
+
+// FirstCommit returns the earliest commit which added the blob
+func (history *BlobHistory) FirstCommit() string {
+	if len(history.commits) == 0 {
+		return ""
+	}
+	return history.commits[len(history.commits)-1]
+}
+
+// LastCommit returns the latest commit which added the blob
+func (history *BlobHistory) LastCommit() string {
+	if len(history.commits) == 0 {
+		return ""
+	}
+	return history.commits[0]
+}
+
+// GetBlobHistory returns map: blob oid => its history in the commits
+// reachable from revs, like "--all" or the refs to rewrite.
+// The history is collected in one pass over the raw diffs of all commits,
+// rather than one 'git rev-list --objects' per blob, and '-m' diffs merges
+// against every parent, so blobs only introduced by merges are not missed.
+func GetBlobHistory(gitbin, path string, revs []string) (map[string]*BlobHistory, error) {
+	blobs := make(map[string]*BlobHistory)
+	seen := make(map[string]bool) // "oid path" and "oid commit"
+	args := []string{"-C", path, "-c", "log.showSignature=false", "log",
+		"--format=%H%x01%P%x01%ct%x01%at%x01%an <%ae>", "--raw", "-z", "--no-abbrev", "--no-renames", "-m", "--root"}
+	args = append(args, revs...)
+	cmd := exec.Command(gitbin, append(args, "--")...)
 	out, err := cmd.StdoutPipe()
 	if err != nil {
-		return "", err
+		return blobs, err
 	}
 	cmd.Stderr = os.Stderr
 
 	err = cmd.Start()
 	if err != nil {
-		return "", err
-	}
-	blobname := ""
+		return blobs, err
+	}
+	// the commit header "<oid>^A<parents>^A<committer date>^A<author date>^A<author>",
+	// followed by its entries like:
+	// ":100644 100644 <old oid> <new oid> M\0<path>\0"
+	var commit, author string
+	var parents []string
+	var commit_date, author_date int64
 	buf := bufio.NewReader(out)
 	for {
-		line, err := buf.ReadString('\n')
+		meta, err := buf.ReadString(0)
 		if err != nil {
 			if err == io.EOF {
 				break
 			}
-			return "", err
+			return blobs, err
+		}
+		meta = strings.Trim(meta, "\n\x00")
+		if !strings.HasPrefix(meta, ":") {
+			header := strings.SplitN(meta, "\x01", 5)
+			if len(header) != 5 {
+				return blobs, fmt.Errorf("bad commit header: %s", meta)
+			}
+			commit, parents, author = header[0], strings.Fields(header[1]), header[4]
+			commit_date, _ = strconv.ParseInt(header[2], 10, 64)
+			author_date, _ = strconv.ParseInt(header[3], 10, 64)
+			continue
+		}
+		name, err := buf.ReadString(0)
+		if err != nil {
+			return blobs, err
 		}
-		// drop LF
-		line = line[:len(line)-1]
+		name = strings.TrimSuffix(name, "\x00")
 
-		if len(line) <= 41 {
+		infos := strings.Fields(meta)
+		if len(infos) < 5 {
 			continue
 		}
-		if line[0:40] == oid {
-			blobname = line[41:]
-			break
+		// the old blob is removed or replaced
+		old_mode, old_oid := infos[0][1:], infos[2]
+		if old_mode != "160000" && strings.Trim(old_oid, "0") != "" && old_oid != infos[3] {
+			history, ok := blobs[old_oid]
+			if !ok {
+				history = &BlobHistory{}
+				blobs[old_oid] = history
+			}
+			if history.removal == nil || commit_date > history.removal.date {
+				history.removal = &BlobRemoval{commit, parents, name, commit_date}
+			}
+		}
+		// deleted files and submodules
+		mode, oid := infos[1], infos[3]
+		if mode == "160000" || strings.Trim(oid, "0") == "" {
+			continue
+		}
+		history, ok := blobs[oid]
+		if !ok {
+			history = &BlobHistory{}
+			blobs[oid] = history
 		}
+		if !seen[oid+" "+name] {
+			seen[oid+" "+name] = true
+			history.paths = append(history.paths, name)
+		}
+		if !seen[oid+" "+commit] {
+			seen[oid+" "+commit] = true
+			history.commits = append(history.commits, commit)
+			// the commits are the latest first
+			history.author, history.date = author, author_date
+		}
+	}
+	if err := cmd.Wait(); err != nil {
+		return blobs, err
+	}
+	for oid, history := range blobs {
+		// only removed, e.g. added by a commit out of revs
+		if len(history.paths) == 0 {
+			delete(blobs, oid)
+			continue
+		}
+		sort.Strings(history.paths)
 	}
-	return blobname, nil
+	return blobs, nil
+}
+
+// ContainingRef is a branch or a tag which contains a commit
+type ContainingRef struct {
+	name   string // full ref name
+	commit string // the commit it points to, annotated tags are peeled
+	date   int64  // committer date of the commit
+}
+
+// RefsContaining returns the branches and tags which contain any of the commits
+func RefsContaining(gitbin, path string, commits []string) []ContainingRef {
+	if len(commits) == 0 {
+		return nil
+	}
+	args := []string{"-C", path, "for-each-ref",
+		"--format=%(refname) %(objectname) %(*objectname) %(committerdate:unix) %(*committerdate:unix)"}
+	for _, commit := range commits {
+		args = append(args, "--contains", commit)
+	}
+	args = append(args, "refs/heads", "refs/tags")
+	out, err := exec.Command(gitbin, args...).Output()
+	if err != nil {
+		return nil
+	}
+	var refs []ContainingRef
+	for _, line := range strings.Split(strings.TrimRight(string(out), "\n"), "\n") {
+		infos := strings.Split(line, " ")
+		if len(infos) != 5 {
+			continue
+		}
+		ref := ContainingRef{name: infos[0], commit: infos[1]}
+		date := infos[3]
+		if infos[2] != "" {
+			ref.commit, date = infos[2], infos[4]
+		}
+		ref.date, _ = strconv.ParseInt(date, 10, 64)
+		refs = append(refs, ref)
+	}
+	return refs
+}
+
+// BranchesContaining returns the branches which contain any of the commits
+func BranchesContaining(gitbin, path string, commits []string) []string {
+	var branches []string
+	for _, ref := range RefsContaining(gitbin, path, commits) {
+		if strings.HasPrefix(ref.name, rewrite.BranchPrefix) {
+			branches = append(branches, strings.TrimPrefix(ref.name, rewrite.BranchPrefix))
+		}
+	}
+	return branches
+}
+
+// GetTreeBlobs returns all the blobs in the tree of the commit
+func GetTreeBlobs(gitbin, path, commit string) map[string]bool {
+	blobs := make(map[string]bool)
+	out, err := exec.Command(gitbin, "-C", path, "ls-tree", "-r", "-z", commit).Output()
+	if err != nil {
+		return blobs
+	}
+	// "<mode> <type> <oid>\t<path>"
+	for _, entry := range strings.Split(string(out), "\x00") {
+		infos := strings.Fields(entry)
+		if len(infos) >= 3 && infos[1] == "blob" {
+			blobs[infos[2]] = true
+		}
+	}
+	return blobs
 }
 
 func parseBatchHeader(header string) (objectid, objecttype, objectsize string, err error) {
@@ -179,19 +383,22 @@ func parseBatchHeader(header string) (objectid, objecttype, objectsize string, e
 	return infos[0], infos[1], infos[2], nil
 }
 
-// GetBlobSize to get repository blobs list
-func GetBlobSize(gitbin, path string) error {
+// GetBlobSize to get repository blobs list, returns the raw sizes and
+// the on-disk sizes, a big text file may be tiny on disk after delta
+func GetBlobSize(gitbin, path string) (map[string]string, map[string]string, error) {
+	blobs := make(map[string]string)
+	disk := make(map[string]string)
 	cmd := exec.Command(gitbin, "-C", path, "cat-file", "--batch-all-objects",
-		"--batch-check=%(objectname) %(objecttype) %(objectsize)")
+		"--batch-check=%(objectname) %(objecttype) %(objectsize) %(objectsize:disk)")
 	out, err := cmd.StdoutPipe()
 	if err != nil {
-		return err
+		return blobs, disk, err
 	}
 
 	cmd.Stderr = os.Stderr
 	err = cmd.Start()
 	if err != nil {
-		return err
+		return blobs, disk, err
 	}
 
 	buf := bufio.NewReader(out)
@@ -201,17 +408,172 @@ func GetBlobSize(gitbin, path string) error {
 			if err == io.EOF {
 				break
 			}
-			return err
+			return blobs, disk, err
 		}
 		objectid, objecttype, objectsize, err := parseBatchHeader(line)
 		if err != nil {
-			return err
+			return blobs, disk, err
 		}
 		if objecttype == "blob" {
-			Blob_size_list[objectid] = objectsize
+			blobs[objectid] = objectsize
+			disk[objectid] = line[strings.LastIndex(line, " ")+1 : len(line)-1]
 		}
 	}
-	return nil
+	return blobs, disk, nil
+}
+
+// CatBlobs streams the blobs via 'git cat-file --batch', and calls fn with
+// the data of every blob in order
+func CatBlobs(gitbin, path string, oids []string, fn func(oid string, data []byte)) error {
+	cmd := exec.Command(gitbin, "-C", path, "cat-file", "--batch")
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go func() {
+		w := bufio.NewWriter(in)
+		for _, oid := range oids {
+			w.WriteString(oid + "\n")
+		}
+		w.Flush()
+		in.Close()
+	}()
+
+	buf := bufio.NewReader(out)
+	for range oids {
+		header, err := buf.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		objectid, _, objectsize, err := parseBatchHeader(header)
+		if err != nil {
+			return err
+		}
+		size, _ := strconv.ParseInt(objectsize, 10, 64)
+		// data and the trailing LF
+		data := make([]byte, size+1)
+		if _, err := io.ReadFull(buf, data); err != nil {
+			return err
+		}
+		fn(objectid, data[:size])
+	}
+	return cmd.Wait()
+}
+
+func NewHistoryRecord(oid string, size, disk uint64, history *BlobHistory) HistoryRecord {
+	return HistoryRecord{
+		oid:        oid,
+		objectSize: size,
+		diskSize:   disk,
+		objectName: strings.Join(history.paths, ", "),
+		paths:      history.paths,
+		commits:    history.commits,
+		author:     history.author,
+		date:       history.date,
+		lastCommit: history.LastCommit(),
+		removal:    history.removal,
+	}
+}
+
+// LookupRefs finds the branches and tags containing every blob of the list,
+// and the latest commit which still has it, that is the newest ref having
+// the blob in its tree, or the parent of the commit which removed it at last.
+// It's done for the scan result only, as it runs git several times per blob.
+func (list BlobList) LookupRefs(ctx *Context) {
+	trees := make(map[string]map[string]bool) // commit => blobs in its tree
+	for i := range list {
+		item := &list[i]
+		item.branches, item.tags = nil, nil
+		var tip *ContainingRef
+		for _, ref := range RefsContaining(ctx.gitBin, ctx.workDir, item.commits) {
+			ref := ref
+			if strings.HasPrefix(ref.name, rewrite.BranchPrefix) {
+				item.branches = append(item.branches, strings.TrimPrefix(ref.name, rewrite.BranchPrefix))
+			} else {
+				item.tags = append(item.tags, strings.TrimPrefix(ref.name, rewrite.TagPrefix))
+			}
+			if _, ok := trees[ref.commit]; !ok {
+				trees[ref.commit] = GetTreeBlobs(ctx.gitBin, ctx.workDir, ref.commit)
+			}
+			if trees[ref.commit][item.oid] && (tip == nil || ref.date > tip.date) {
+				tip = &ref
+			}
+		}
+		if tip != nil {
+			item.lastCommit = tip.commit
+			continue
+		}
+		if item.removal == nil {
+			continue
+		}
+		// for a merge, the parent which still has the blob at the path
+		for _, parent := range item.removal.parents {
+			out, err := exec.Command(ctx.gitBin, "-C", ctx.workDir, "rev-parse", "--verify", "-q",
+				parent+":"+item.removal.path).Output()
+			if err == nil && strings.TrimSpace(string(out)) == item.oid {
+				item.lastCommit = parent
+				break
+			}
+		}
+	}
+}
+
+// ScanRevs returns the revisions to scan, which are the same as the ones
+// to rewrite, so that the scan result agrees with what '--delete' removes
+func (ctx *Context) ScanRevs() ([]string, error) {
+	if ctx.opts.refs != nil {
+		repo := &rewrite.Repository{GitBin: ctx.gitBin, WorkDir: ctx.workDir}
+		return repo.ExpandRefs(ctx.opts.refs)
+	}
+	if ctx.opts.branch == DefaultRepoBranch || ctx.opts.branch == "--all" {
+		return []string{"--all"}, nil
+	}
+	return []string{ctx.opts.branch}, nil
+}
+
+// size returns the on-disk size with '--disk-size', otherwise the raw size
+func (record HistoryRecord) size(disk bool) uint64 {
+	if disk {
+		return record.diskSize
+	}
+	return record.objectSize
+}
+
+// BlobSize returns the size of the blob which '--limit' applies to,
+// the on-disk size with '--disk-size', otherwise the raw size
+func (ctx *Context) BlobSize(oid string) uint64 {
+	sizes := ctx.blob_size_list
+	if ctx.opts.disksize {
+		sizes = ctx.blob_disk_size
+	}
+	// set bitsize to 64, means max single blob size is 4 GiB
+	size, _ := strconv.ParseUint(sizes[oid], 10, 64)
+	return size
+}
+
+// MatchFileType reports whether any of the paths has one of the file types,
+// which are separated by ',', like "zip" or "tar.gz,so"
+func MatchFileType(paths []string, types string) bool {
+	for _, t := range strings.Split(types, ",") {
+		t = strings.TrimPrefix(strings.TrimSpace(t), ".")
+		if t == "" {
+			continue
+		}
+		for _, path := range paths {
+			if strings.HasSuffix(path, "."+t) {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 func ScanRepository(context *Context) (BlobList, error) {
@@ -221,10 +583,42 @@ func ScanRepository(context *Context) (BlobList, error) {
 	if context.opts.verbose {
 		PrintLocalWithGreenln("start scanning")
 	}
+	revs, err := context.ScanRevs()
+	if err != nil {
+		return empty, err
+	}
+	blob_history, err := GetBlobHistory(context.gitBin, context.workDir, revs)
+	if err != nil {
+		return empty, fmt.Errorf(LocalPrinter().Sprintf(
+			"run GetBlobHistory error: %s", err))
+	}
+	context.unreachable = nil
+
+	// LFS pointers are already converted, they are never scanned
+	limit, err := UnitConvert(context.opts.limit)
+	if err != nil {
+		return empty, fmt.Errorf(LocalPrinter().Sprintf(
+			"convert uint error: %s", err))
+	}
+	var candidates []string
+	for objectid, objectsize := range context.blob_size_list {
+		raw_size, _ := strconv.ParseUint(objectsize, 10, 64)
+		if raw_size < uint64(rewrite.LFS_POINTER_MAX_SIZE) && context.BlobSize(objectid) > limit {
+			candidates = append(candidates, objectid)
+		}
+	}
+	if err := context.ReadLFSPointers(candidates); err != nil {
+		return empty, err
+	}
 
-	for objectid, objectsize := range Blob_size_list {
+	for objectid, objectsize := range context.blob_size_list {
+		if context.lfs_pointers[objectid] != nil {
+			continue
+		}
 		// set bitsize to 64, means max single blob size is 4 GiB
-		actual_size, _ := strconv.ParseUint(objectsize, 10, 64)
+		raw_size, _ := strconv.ParseUint(objectsize, 10, 64)
+		disk_size, _ := strconv.ParseUint(context.blob_disk_size[objectid], 10, 64)
+		actual_size := context.BlobSize(objectid)
 		// e.g. git repo-clean -s -l=1000k --lfs --type=po --delete
 		if context.opts.lfs && !context.opts.interact {
 			limit, err := UnitConvert(context.opts.limit)
@@ -232,30 +626,22 @@ func ScanRepository(context *Context) (BlobList, error) {
 				return empty, fmt.Errorf(LocalPrinter().Sprintf(
 					"convert uint error: %s", err))
 			}
-			// to protect LFS file itself
-			if limit < 200 {
-				context.opts.limit = LFS_SAFE_SIZE
-			}
 			if actual_size > limit {
-				name, err := GetBlobName(context.gitBin, context.workDir, objectid)
-				if err != nil && err != io.EOF {
-					return empty, fmt.Errorf(LocalPrinter().Sprintf(
-						"run GetBlobName error: %s", err))
-				}
-				if name == "" {
+				history, ok := blob_history[objectid]
+				if !ok {
 					continue
 				}
 				if len(context.opts.types) != 0 && context.opts.types != DefaultFileType {
-					extent := filepath.Ext(name)
-					if extent == "."+context.opts.types {
-						// append this record blob into slice
-						blobs = append(blobs, HistoryRecord{objectid, actual_size, name})
-						// sort according by size
-						sort.Slice(blobs, func(i, j int) bool {
-							return blobs[i].objectSize > blobs[j].objectSize
-						})
+					if !MatchFileType(history.paths, context.opts.types) {
+						continue
 					}
 				}
+				// append this record blob into slice
+				blobs = append(blobs, NewHistoryRecord(objectid, raw_size, disk_size, history))
+				// sort according by size
+				sort.Slice(blobs, func(i, j int) bool {
+					return blobs[i].size(context.opts.disksize) > blobs[j].size(context.opts.disksize)
+				})
 			}
 		} else {
 			limit, err := UnitConvert(context.opts.limit)
@@ -265,27 +651,31 @@ func ScanRepository(context *Context) (BlobList, error) {
 			}
 
 			if actual_size > limit {
-				name, err := GetBlobName(context.gitBin, context.workDir, objectid)
-				if err != nil && err != io.EOF {
-					return empty, fmt.Errorf(LocalPrinter().Sprintf(
-						"run GetBlobName error: %s", err))
-				}
-				if name == "" {
+				history, ok := blob_history[objectid]
+				if !ok {
+					// unreachable objects, or only on the other branches,
+					// they have no path to match '--type'
+					if context.opts.types == DefaultFileType {
+						context.unreachable = append(context.unreachable, NewHistoryRecord(objectid, raw_size, disk_size, &BlobHistory{}))
+					}
 					continue
 				}
 				if len(context.opts.types) != 0 && context.opts.types != DefaultFileType {
-					extent := filepath.Ext(name)
-					if extent != "."+context.opts.types {
+					if !MatchFileType(history.paths, context.opts.types) {
 						// matched none, skip
 						continue
 					}
 				}
 
 				// append this record blob into slice
-				blobs = append(blobs, HistoryRecord{objectid, actual_size, name})
+				blobs = append(blobs, NewHistoryRecord(objectid, raw_size, disk_size, history))
+				// all blobs are needed by '--group-by'
+				if context.opts.groupby != "" {
+					continue
+				}
 				// sort according by size
 				sort.Slice(blobs, func(i, j int) bool {
-					return blobs[i].objectSize > blobs[j].objectSize
+					return blobs[i].size(context.opts.disksize) > blobs[j].size(context.opts.disksize)
 				})
 				// remain first {op.number} blobs
 				if len(blobs) > int(context.opts.number) {
@@ -295,6 +685,9 @@ func ScanRepository(context *Context) (BlobList, error) {
 			}
 		}
 	}
+	sort.Slice(context.unreachable, func(i, j int) bool {
+		return context.unreachable[i].size(context.opts.disksize) > context.unreachable[j].size(context.opts.disksize)
+	})
 	return blobs, nil
 }
 
@@ -307,11 +700,23 @@ func ScanMode(ctx *Context) (result []string) {
 		PrintRedln(ft)
 		os.Exit(1)
 	}
-	if len(bloblist) == 0 {
+	if len(bloblist) == 0 && ctx.opts.format != "table" {
+		// an empty result for scripts, which check the exit code too
+		OutputScanResult(ctx, bloblist)
+		fmt.Fprintln(os.Stderr, LocalPrinter().Sprintf("no files were scanned"))
+		os.Exit(0)
+	} else if len(bloblist) == 0 {
+		if !ctx.opts.ScanToStdout() {
+			ShowUnreachableResult(ctx.unreachable, ctx.opts.number)
+			ShowLFSReport(ctx)
+		}
 		PrintLocalWithRedln("no files were scanned")
 		os.Exit(1)
 	} else {
-		ShowScanResult(bloblist)
+		OutputScanResult(ctx, bloblist)
+		if !ctx.opts.ScanToStdout() {
+			ShowLFSReport(ctx)
+		}
 	}
 
 	if ctx.opts.interact {
@@ -335,7 +740,9 @@ func ScanMode(ctx *Context) (result []string) {
 	for _, item := range bloblist {
 		for _, target := range result {
 			if item.oid == target {
-				Files_changed.Add(item.objectName)
+				for _, path := range item.paths {
+					ctx.files_changed.Add(path)
+				}
 			}
 		}
 	}
@@ -350,8 +757,12 @@ func NonScanMode(ctx *Context, file_limit string, file_type string, file_num uin
 
 func ScanFiles(ctx *Context) ([]string, error) {
 	var scanned_targets []string
-	// when run git-repo-clean -i, its means run scan too
-	if ctx.opts.interact {
+	// '--scan-secrets -i' only selects the findings, see SecretsMode()
+	if ctx.opts.interact && ctx.opts.secrets {
+		ctx.opts.delete = true
+		ctx.opts.verbose = true
+	} else if ctx.opts.interact {
+		// when run git-repo-clean -i, its means run scan too
 		ctx.opts.scan = true
 		ctx.opts.delete = true
 		ctx.opts.verbose = true
@@ -366,41 +777,45 @@ func ScanFiles(ctx *Context) ([]string, error) {
 
 	// set default branch to all is to keep deleting process consistent with scanning process
 	// user end pass '--branch=all', but git-fast-export takes '--all'
-	if op.branch == DefaultRepoBranch {
-		op.branch = "--all"
+	if ctx.opts.branch == DefaultRepoBranch {
+		ctx.opts.branch = "--all"
 	}
 
-	if ctx.opts.lfs {
-		limit, _ := UnitConvert(ctx.opts.limit)
-		if limit < 200 {
-			ctx.opts.limit = LFS_SAFE_SIZE
-		}
-		// can't run lfs-migrate in bare repo
-		// git lfs track must be run in a work tree.
-		if ctx.bare {
-			PrintLocalWithYellowln("bare repo error")
-			os.Exit(1)
-		}
-	}
-	if ctx.opts.limit == DefaultFileSize && ctx.opts.scan {
+	// '--group-by' sums up all the files by default
+	if ctx.opts.limit == DefaultFileSize && ctx.opts.scan && ctx.opts.groupby == "" {
 		ctx.opts.limit = "1M" // set default to 1M for scan
 	}
 
-	PrintLocalWithPlain("current repository size")
-	PrintLocalWithYellowln(GetDatabaseSize(ctx.workDir, ctx.bare))
-	if lfs := GetLFSObjSize(ctx.workDir); len(lfs) > 0 {
-		PrintLocalWithPlain("including LFS objects size")
-		PrintLocalWithYellowln(lfs)
+	// keep stdout for the scan result of '--format'
+	if !ctx.opts.ScanToStdout() {
+		PrintLocalWithPlain("current repository size")
+		PrintLocalWithYellowln(GetDatabaseSize(ctx.workDir, ctx.bare))
+		if lfs := GetLFSObjSize(ctx.LFSDir()); len(lfs) > 0 {
+			PrintLocalWithPlain("including LFS objects size")
+			PrintLocalWithYellowln(lfs)
+		}
 	}
 
-	if ctx.opts.scan {
+	if ctx.opts.secrets {
+		scanned_targets = SecretsMode(ctx)
+	} else if ctx.opts.groupby != "" {
+		GroupMode(ctx)
+	} else if ctx.opts.scan {
 		scanned_targets = ScanMode(ctx)
+	} else if ctx.opts.lfs {
+		// all the filters apply together, see LFSFilterMode()
+		scanned_targets = LFSFilterMode(ctx)
 	} else if ctx.opts.files != nil {
 		/* Filter by provided files
 		 * Default: file size limit and file type
 		 * Max file number limit
 		 */
 		ctx.scan_t.filepath = true
+		paths, err := rewrite.NewPathMatcher(ctx.opts.files)
+		if err != nil {
+			return nil, err
+		}
+		ctx.paths = paths
 		NonScanMode(ctx, DefaultFileSize, DefaultFileType, math.MaxUint32)
 	} else if ctx.opts.limit != DefaultFileSize {
 		/* Filter by file size
@@ -418,11 +833,11 @@ func ScanFiles(ctx *Context) ([]string, error) {
 		NonScanMode(ctx, DefaultFileSize, ctx.opts.types, math.MaxUint32)
 	}
 
-	if !ctx.opts.delete {
-		os.Exit(1)
-	}
-	if (ctx.scan_t.filepath || ctx.scan_t.filesize || ctx.scan_t.filetype) && ctx.opts.lfs {
-		PrintLocalWithRedln("Convert LFS file error")
+	if !ctx.opts.delete && !ctx.opts.dryrun {
+		// scripts consuming the scan result check the exit code
+		if ctx.opts.format != "table" || ctx.opts.output != "" {
+			os.Exit(0)
+		}
 		os.Exit(1)
 	}
 	return scanned_targets, nil
@@ -440,6 +855,35 @@ func GitDir(gitbin, path string) (string, error) {
 	return string(bytes.TrimSpace(out)), nil
 }
 
+// LFSStorageDir returns the LFS storage dir like git-lfs does: it's
+// 'lfs.storage' if configured, relative to the git dir, otherwise 'lfs' in
+// the git dir. The linked worktrees share the storage of the main one.
+func LFSStorageDir(gitbin, path string) (string, error) {
+	cmd := exec.Command(gitbin, "-C", path, "rev-parse", "--git-common-dir")
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf(
+			"could not run 'git rev-parse --git-common-dir': %s", err,
+		)
+	}
+	// relative to the path, with Git older than 2.31 which has no '--path-format'
+	commondir := string(bytes.TrimSpace(out))
+	if !filepath.IsAbs(commondir) {
+		if commondir, err = filepath.Abs(filepath.Join(path, commondir)); err != nil {
+			return "", err
+		}
+	}
+	storage := "lfs"
+	cmd = exec.Command(gitbin, "-C", path, "config", "--get", "--path", "lfs.storage")
+	if out, err := cmd.Output(); err == nil && len(bytes.TrimSpace(out)) != 0 {
+		storage = string(bytes.TrimSpace(out))
+	}
+	if filepath.IsAbs(storage) {
+		return storage, nil
+	}
+	return filepath.Join(commondir, storage), nil
+}
+
 // check if the current repository is bare repo
 func IsBare(gitbin, path string) (bool, error) {
 	cmd := exec.Command(gitbin, "-C", path, "rev-parse", "--is-bare-repository")
@@ -497,7 +941,7 @@ func GitVersion(gitbin string) (string, error) {
 	if err != nil {
 		return "", fmt.Errorf(LocalPrinter().Sprintf("could not run 'git version': %s", err))
 	}
-	matches := Match("[0-9]+.[0-9]+.[0-9]+.?[0-9]?", string(out))
+	matches := rewrite.Match("[0-9]+.[0-9]+.[0-9]+.?[0-9]?", string(out))
 	if len(matches) == 0 {
 		return "", fmt.Errorf(LocalPrinter().Sprintf("match git version wrong"))
 	}
@@ -568,9 +1012,9 @@ func GetDatabaseSize(dir string, bare bool) string {
 	return strings.TrimSuffix(string(out), "\n")
 }
 
-// get lfs objects data size
+// get lfs objects data size, dir is the LFS storage dir
 func GetLFSObjSize(dir string) string {
-	path := filepath.Join(dir, ".git/lfs")
+	path := filepath.Join(dir, "objects")
 	if _, err := os.Stat(path); err == nil {
 		cmd := exec.Command("du", "-hs", path)
 		out, err := cmd.Output()
@@ -665,8 +1109,8 @@ func PushRepo(gitbin, path string) error {
 }
 
 // BrachesChanged prints all branches that have been changed
-func BrachesChanged() bool {
-	branches := Branch_changed.ToSlice()
+func (context Context) BrachesChanged() bool {
+	branches := context.branch_changed.ToSlice()
 	if len(branches) != 0 {
 		PrintLocalWithYellowln("branches have been changed")
 		for _, branch := range branches {
@@ -690,8 +1134,8 @@ func BrachesChanged() bool {
 }
 
 // FilesChanged prints all files that have been changed
-func FilesChanged() {
-	files := Files_changed.ToSlice()
+func (context Context) FilesChanged() {
+	files := context.files_changed.ToSlice()
 	if len(files) != 0 {
 		PrintLocalWithPlainln("file have been changed")
 		for _, file := range files {
@@ -701,7 +1145,7 @@ func FilesChanged() {
 }
 
 func (context Context) CleanUp() {
-	if BrachesChanged() || context.opts.lfs {
+	if context.BrachesChanged() || context.opts.lfs {
 		// clean up
 		PrintLocalWithGreenln("file cleanup is complete. Start cleaning the repository")
 	} else {
@@ -764,25 +1208,27 @@ func (context Context) CleanUp() {
 	}
 }
 
-func LFSPrompt() {
-	FilesChanged()
+func (context Context) LFSPrompt() {
+	context.FilesChanged()
 	PrintLocalWithPlainln("before you push to remote, you have to do something below:")
 	PrintLocalWithYellowln("1. install git-lfs")
 	PrintLocalWithYellowln("2. run command: git lfs install")
-	PrintLocalWithYellowln("3. edit .gitattributes file")
-	PrintLocalWithYellowln("4. commit your .gitattributes file.")
+	PrintLocalWithPlainln(".gitattributes has been updated in every rewritten commit to track the LFS files")
 }
 
 func (context Context) Prompt() {
 	PrintLocalWithGreenln("cleaning completed")
 	PrintLocalWithPlain("current repository size")
 	PrintLocalWithYellowln(GetDatabaseSize(context.workDir, context.bare))
-	if lfs := GetLFSObjSize(context.workDir); len(lfs) > 0 {
+	if lfs := GetLFSObjSize(context.LFSDir()); len(lfs) > 0 {
 		PrintLocalWithPlain("including LFS objects size")
 		PrintLocalWithYellowln(lfs)
 	}
 	if context.opts.lfs {
-		LFSPrompt()
+		context.LFSPrompt()
+	}
+	if context.opts.lfsexport {
+		PrintYellowln(LocalPrinter().Sprintf("the rewritten history doesn't need the LFS objects in %s any more", context.LFSDir()))
 	}
 	var pushed bool
 	if !context.opts.lfs {
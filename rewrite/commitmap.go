@@ -0,0 +1,122 @@
+package rewrite
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const ZeroOid = "0000000000000000000000000000000000000000"
+
+// ShowRefs lists every ref of the repository, returns map: ref => oid
+func (repo *Repository) ShowRefs() (map[string]string, error) {
+	refs := make(map[string]string)
+	cmd := repo.GitCommand("for-each-ref", "--format=%(objectname) %(refname)")
+	out, err := cmd.Output()
+	if err != nil {
+		return refs, fmt.Errorf("could not run 'git for-each-ref': %s", err)
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		infos := strings.SplitN(line, " ", 2)
+		if len(infos) != 2 {
+			continue
+		}
+		refs[infos[1]] = infos[0]
+	}
+	return refs, nil
+}
+
+// ReadMarks parses the file written by 'git fast-import --export-marks',
+// returns map: mark id => new oid
+func ReadMarks(path string) (map[int32]string, error) {
+	marks := make(map[int32]string)
+	f, err := os.Open(path)
+	if err != nil {
+		return marks, err
+	}
+	defer f.Close()
+
+	buf := bufio.NewReader(f)
+	for {
+		line, err := buf.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return marks, err
+		}
+		// pattern: :mark oid
+		if infos := strings.Split(strings.TrimSpace(line), " "); len(infos) == 2 && strings.HasPrefix(infos[0], ":") {
+			if id, err := strconv.Atoi(infos[0][1:]); err == nil {
+				marks[int32(id)] = infos[1]
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	return marks, nil
+}
+
+// write commit-map and ref-map into MapDir, so that links to the old
+// history can be migrated:
+//
+// commit-map: "old-oid new-oid" per line, new-oid is ZeroOid if the commit has been dropped
+// ref-map: "old-oid new-oid refname" per line, new-oid is ZeroOid if the ref has been deleted
+func (r *Rewriter) writeMaps(marksfile string, old_refs map[string]string) error {
+	marks, err := ReadMarks(marksfile)
+	if err != nil {
+		return err
+	}
+
+	commits := make([]string, 0, len(r.Session.commit_oids)+len(r.Report.DroppedCommits))
+	for mark, old_oid := range r.Session.commit_oids {
+		if new_oid, ok := marks[mark]; ok {
+			commits = append(commits, old_oid+" "+new_oid+"\n")
+		}
+	}
+	for _, commit := range r.Report.DroppedCommits {
+		commits = append(commits, commit.OriginalOid+" "+ZeroOid+"\n")
+	}
+	sort.Strings(commits)
+	if err := writeLines(filepath.Join(r.MapDir, "commit-map"), commits); err != nil {
+		return err
+	}
+
+	new_refs, err := r.Repo.ShowRefs()
+	if err != nil {
+		return err
+	}
+	refs := make([]string, 0, len(old_refs))
+	for ref, old_oid := range old_refs {
+		new_ref := ref
+		if renamed, ok := r.Report.RenamedRefs[ref]; ok {
+			new_ref = renamed
+		}
+		new_oid, ok := new_refs[new_ref]
+		if !ok {
+			new_oid = ZeroOid
+		}
+		refs = append(refs, old_oid+" "+new_oid+" "+ref+"\n")
+	}
+	sort.Strings(refs)
+	return writeLines(filepath.Join(r.MapDir, "ref-map"), refs)
+}
+
+func writeLines(path string, lines []string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, line := range lines {
+		w.WriteString(line)
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
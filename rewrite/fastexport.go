@@ -1,8 +1,9 @@
-package main
+package rewrite
 
 import (
 	"bufio"
 	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
 )
@@ -13,9 +14,12 @@ type FEOutPutIter struct {
 	out     io.ReadCloser
 	f       *bufio.Reader
 	errChan <-chan error
+	session *Session // elements parsed from this stream belong to this session
 }
 
-func (repo *Repository) NewFastExportIter() (*FEOutPutIter, error) {
+// NewFastExportIter runs a git-fast-export process on the given refs
+// ("--all" for all refs). Blob contents are only exported when withData is set.
+func (repo *Repository) NewFastExportIter(session *Session, refs []string, withData bool) (*FEOutPutIter, error) {
 
 	args := []string{
 		"-c",
@@ -28,18 +32,15 @@ func (repo *Repository) NewFastExportIter() (*FEOutPutIter, error) {
 		"--use-done-feature",
 		"--mark-tags",    // git >= 2.24.0
 		"--reencode=yes", // git >= 2.23.0
-		repo.context.opts.branch,
-		"--no-data",
 	}
-	// drop "--no-data"
-	if repo.context.opts.lfs {
-		args = args[:len(args)-1]
+	args = append(args, refs...)
+	if !withData {
+		args = append(args, "--no-data")
 	}
 
 	cmd := repo.GitCommand(args...)
 	out, err := cmd.StdoutPipe()
 	if err != nil {
-		out.Close()
 		return nil, err
 	}
 
@@ -55,9 +56,21 @@ func (repo *Repository) NewFastExportIter() (*FEOutPutIter, error) {
 		out:     out,
 		f:       bufio.NewReader(out),
 		errChan: make(chan error, 1),
+		session: session,
 	}, nil
 }
 
+// NewStreamIter iterates over a fast-export stream which has been produced
+// elsewhere, e.g. saved into a file
+func NewStreamIter(session *Session, stream io.Reader) *FEOutPutIter {
+	return &FEOutPutIter{
+		out:     ioutil.NopCloser(stream),
+		f:       bufio.NewReader(stream),
+		errChan: make(chan error, 1),
+		session: session,
+	}
+}
+
 // get data line by line from output stream
 func (iter *FEOutPutIter) Next() (string, error) {
 	errChan := make(chan error, 1)
@@ -74,6 +87,9 @@ func (iter *FEOutPutIter) Next() (string, error) {
 
 func (iter *FEOutPutIter) Close() error {
 	err := iter.out.Close()
+	if iter.cmd == nil {
+		return err
+	}
 	err2 := iter.cmd.Wait()
 	if err == nil {
 		err = err2
@@ -0,0 +1,46 @@
+package rewrite
+
+import (
+	"io"
+	"os"
+	"os/exec"
+)
+
+// run a git-fast-import process
+// but keep repo path the same with git-fast-export
+// return a Writer for stream pipeline to feed data into this process
+func (repo *Repository) FastImportOut(extra_args ...string) (io.WriteCloser, *exec.Cmd, error) {
+	in, _, cmd, err := repo.FastImportPipes(extra_args...)
+	return in, cmd, err
+}
+
+// FastImportPipes is like FastImportOut, but also returns the stdout of
+// git-fast-import, where the responses to 'get-mark' commands are written
+func (repo *Repository) FastImportPipes(extra_args ...string) (io.WriteCloser, io.ReadCloser, *exec.Cmd, error) {
+	args := []string{
+		"-c",
+		"core.ignorecase=false",
+		"fast-import",
+		"--quiet",
+		"--force",
+		// "--date-format=raw-permissive", // 2.28.0
+	}
+	args = append(args, extra_args...)
+	cmd := repo.GitCommand(args...)
+
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Start(); err != nil {
+		return nil, nil, nil, err
+	}
+
+	return in, out, cmd, nil
+}
@@ -0,0 +1,550 @@
+// Package rewrite is the history rewrite engine of git-repo-clean.
+//
+// It parses the output stream of git-fast-export into Blob, Commit, Reset and
+// Tag elements, passes every element through a Filter, and feeds what is left
+// into git-fast-import:
+//
+//	fast-export --> parser --> Filter --> fast-import
+//
+// Cleaning rules are written as Filter implementations and run by a Rewriter.
+package rewrite
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Filter is the set of callbacks a Rewriter invokes for every element parsed
+// from the fast-export stream. A callback may modify the element in place,
+// or call its Skip method to drop it from the rewritten history.
+type Filter interface {
+	// TweakBlob is called for every blob, blobs are only exported
+	// when the Rewriter runs with data.
+	TweakBlob(blob *Blob)
+	// TweakFileChange is called for every filechange of a commit,
+	// return false to drop the filechange.
+	TweakFileChange(commit *Commit, filechange *FileChange) bool
+	// TweakCommit is called after the filechanges of the commit have been
+	// filtered, a commit that became empty is already skipped at this point.
+	TweakCommit(commit *Commit, helper *HelperInfo)
+	TweakReset(reset *Reset)
+	TweakTag(tag *Tag)
+}
+
+// NopFilter keeps every element untouched,
+// embed it to implement only the callbacks you need.
+type NopFilter struct{}
+
+func (NopFilter) TweakBlob(blob *Blob)                                        {}
+func (NopFilter) TweakFileChange(commit *Commit, filechange *FileChange) bool { return true }
+func (NopFilter) TweakCommit(commit *Commit, helper *HelperInfo)              {}
+func (NopFilter) TweakReset(reset *Reset)                                     {}
+func (NopFilter) TweakTag(tag *Tag)                                           {}
+
+// FilterChain runs several filters in order, a filechange is kept only if
+// every filter keeps it, and once an element is skipped the rest of the
+// filters won't see it.
+type FilterChain []Filter
+
+func (chain FilterChain) TweakBlob(blob *Blob) {
+	for _, f := range chain {
+		if !blob.Ele.Base.Dumped {
+			return
+		}
+		f.TweakBlob(blob)
+	}
+}
+
+func (chain FilterChain) TweakFileChange(commit *Commit, filechange *FileChange) bool {
+	for _, f := range chain {
+		if !f.TweakFileChange(commit, filechange) {
+			return false
+		}
+	}
+	return true
+}
+
+func (chain FilterChain) TweakCommit(commit *Commit, helper *HelperInfo) {
+	for _, f := range chain {
+		if !commit.Ele.Base.Dumped {
+			return
+		}
+		f.TweakCommit(commit, helper)
+	}
+}
+
+func (chain FilterChain) TweakReset(reset *Reset) {
+	for _, f := range chain {
+		if !reset.Base.Dumped {
+			return
+		}
+		f.TweakReset(reset)
+	}
+}
+
+func (chain FilterChain) TweakTag(tag *Tag) {
+	for _, f := range chain {
+		if !tag.Ele.Base.Dumped {
+			return
+		}
+		f.TweakTag(tag)
+	}
+}
+
+// Rewriter drives the whole pipeline: fast-export | Filter | fast-import
+type Rewriter struct {
+	Repo     *Repository
+	Session  *Session // state of this run, a new one is created if it's nil
+	Filter   Filter
+	Branch   string // branch passed to git-fast-export, "--all" means all refs
+	WithData bool   // export blob contents, which is needed to tweak blobs
+	// Refs selects the refs to rewrite instead of Branch, see ExpandRefs
+	// for the syntax, e.g. []string{"refs/heads/release/*", "^refs/pull/*"}.
+	Refs []string
+	// DryRun runs the whole pipeline but discards the fast-import stream,
+	// so the repository is left untouched, see Report for what would change.
+	DryRun bool
+	Report *Report // filled while filtering, a new one is created if it's nil
+	// MapDir is where commit-map and ref-map are written after the rewrite,
+	// they map every old commit and ref to its new oid. Leave it empty to
+	// skip them.
+	MapDir string
+	// RewriteOids replaces the full and abbreviated commit oids referenced by
+	// commit and tag messages, e.g. "Reverts abc1234", with the rewritten ones.
+	// It has no effect on a dry run, as no new oid is generated.
+	RewriteOids bool
+	// PathRenames moves files to other places, every path is renamed by the
+	// rules in order after the Filter has seen it.
+	PathRenames []PathRename
+	// ReplaceText redacts text in every blob, it needs WithData.
+	ReplaceText []*ReplaceRule
+	// Mailmap rewrites the identities of authors, committers and taggers.
+	Mailmap *Mailmap
+	// MessageFilter rewrites commit and tag messages.
+	MessageFilter *MessageFilter
+	// RefRenames renames branches and tags, the first matched rule wins.
+	RefRenames []RefRename
+	// LFSAttributes are the .gitattributes patterns of the files converted
+	// into LFS, they are added into the .gitattributes of every commit.
+	LFSAttributes []string
+	// LFS converts the selected blobs into LFS pointers, it needs WithData.
+	LFS *LFSConverter
+	// LFSExport replaces LFS pointers by their objects, and removes the LFS
+	// attributes from .gitattributes, it needs WithData too.
+	LFSExport *LFSExporter
+
+	marks *markQuerier
+}
+
+// Run rewrites the history of the repository
+func (r *Rewriter) Run() error {
+	if r.Session == nil {
+		r.Session = NewSession()
+	}
+	var err error
+	refs := []string{r.Branch}
+	if len(r.Refs) != 0 {
+		if refs, err = r.Repo.ExpandRefs(r.Refs); err != nil {
+			return err
+		}
+	}
+	iter, err := r.Repo.NewFastExportIter(r.Session, refs, r.WithData)
+	if err != nil {
+		return err
+	}
+	defer iter.Close()
+
+	if r.DryRun {
+		return r.Filtering(iter, ioutil.Discard)
+	}
+
+	var args []string
+	var old_refs map[string]string
+	var marksfile string
+	if r.MapDir != "" {
+		if old_refs, err = r.Repo.ShowRefs(); err != nil {
+			return err
+		}
+		if err = os.MkdirAll(r.MapDir, 0755); err != nil {
+			return err
+		}
+		marksfile = filepath.Join(r.MapDir, "fast-import-marks")
+		defer os.Remove(marksfile)
+		args = append(args, "--export-marks="+marksfile)
+	}
+
+	input, answers, cmd, err := r.Repo.FastImportPipes(args...)
+	if err != nil {
+		return err
+	}
+	if r.RewriteOids {
+		r.marks = newMarkQuerier(input, answers)
+	}
+	err = r.Filtering(iter, input)
+	if err != nil {
+		// git-fast-import would update the refs by the partial stream at EOF
+		cmd.Process.Kill()
+	}
+	input.Close()
+	// marks are exported when git-fast-import exits
+	if err2 := cmd.Wait(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		return err
+	}
+	for _, ref := range r.Report.DeletedRefs {
+		if out, err := r.Repo.GitCommand("update-ref", "-d", ref).CombinedOutput(); err != nil {
+			return fmt.Errorf("could not delete ref %s: %s", ref, out)
+		}
+	}
+	if err := r.remove_renamed_refs(); err != nil {
+		return err
+	}
+
+	if r.MapDir != "" {
+		return r.writeMaps(marksfile, old_refs)
+	}
+	return nil
+}
+
+// Filtering reads every element from iter, filters it,
+// and dumps the remaining ones into output
+func (r *Rewriter) Filtering(iter *FEOutPutIter, output io.Writer) error {
+	r.Session = iter.session
+	if r.Report == nil {
+		r.Report = NewReport()
+	}
+	for {
+		line, err := iter.Next()
+		if err != nil {
+			return err
+		}
+		if len(line) == 0 {
+			// EOF
+			r.update_pruned_refs(output)
+			return nil
+		}
+		if matches := Match("feature done\n$", line); len(matches) != 0 {
+			continue
+		} else if matches := Match("^blob\n$", line); len(matches) != 0 {
+			blob := iter.parse_blob_header(line)
+			if blob.Ele == nil {
+				continue
+			}
+			size := blob.DataSize
+			if r.LFS != nil && r.LFS.Select(blob) {
+				lfsdir := r.LFS.Dir
+				if r.DryRun {
+					lfsdir = ""
+				}
+				err = iter.read_lfs_blob(blob, lfsdir)
+			} else {
+				err = iter.read_blob_data(blob)
+			}
+			if err != nil {
+				return err
+			}
+			if r.LFSExport != nil {
+				r.export_lfs_blob(blob)
+			}
+			r.tweak_blob(blob, size)
+
+			if blob.Ele.Base.Dumped {
+				if err := blob.Dump(output); err != nil {
+					return err
+				}
+			}
+
+		} else if matches := Match("commit (.*)\n$", line); len(matches) != 0 {
+			commit, aux_info, err := iter.ParseCommit(line)
+			if err != nil {
+				return err
+			}
+			r.tweak_commit(commit, aux_info)
+			commit.Branch = r.rename_ref(commit.Branch)
+
+			if commit.Ele.Base.Dumped {
+				delete(r.Session.pruned_tips, commit.Branch)
+				commit.Dump(output)
+			} else {
+				r.Session.pruned_tips[commit.Branch] = r.Session.ids.translate(commit.OldID)
+			}
+
+		} else if matches := Match("reset (.*)\n$", line); len(matches) != 0 {
+			reset, err := iter.ParseReset(line)
+			if err != nil {
+				return err
+			}
+			r.tweak_reset(reset)
+
+			if reset.Base.Dumped {
+				reset.Ref = r.rename_ref(reset.Ref)
+				delete(r.Session.pruned_tips, reset.Ref)
+				reset.Dump(output)
+			}
+		} else if matches := Match("tag (.*)\n$", line); len(matches) != 0 {
+			tag, err := iter.ParseTag(line)
+			if err != nil {
+				return err
+			}
+			r.tweak_tag(tag)
+
+			if tag.Ele.Base.Dumped {
+				tag.TagName = r.rename_ref(tag.TagName)
+				tag.Dump(output)
+			}
+		} else if matches := Match("done\n$", line); len(matches) != 0 {
+			r.update_pruned_refs(output)
+			return nil
+		}
+	}
+}
+
+// tweak git objects
+
+// size is the blob size in fast-export, before being converted into LFS
+func (r *Rewriter) tweak_blob(blob *Blob, size int64) {
+	// not the data any more, but the LFS pointer
+	if len(r.ReplaceText) != 0 && blob.Sha256 == "" {
+		if data, replaced := replace_text(r.ReplaceText, blob.Data); replaced {
+			blob.Data = data
+			blob.DataSize = int64(len(data))
+			r.Session.redacted_blobs[blob.Ele.ID] = true
+			r.Report.RedactedBlobs = append(r.Report.RedactedBlobs, blob.OriginalOid)
+		}
+	}
+	r.Filter.TweakBlob(blob)
+
+	if !blob.Ele.Base.Dumped {
+		r.Report.FreedBytes += size
+	} else if blob.DataSize < size {
+		r.Report.FreedBytes += size - blob.DataSize
+	}
+}
+
+func (r *Rewriter) tweak_commit(commit *Commit, helper *HelperInfo) {
+	var (
+		record      = NewCommitRecord(commit)
+		filechanges = len(commit.FileChanges)
+		message     = commit.Message
+		author      = commit.Author
+		commiter    = commit.Commiter
+		changed     bool // filechanges renamed, or refer to redacted blobs
+	)
+	defer func() {
+		if commit.Ele.Base.Dumped && r.Mailmap != nil {
+			commit.Author = r.Mailmap.map_user_line(commit.Author)
+			commit.Commiter = r.Mailmap.map_user_line(commit.Commiter)
+		}
+		if commit.Ele.Base.Dumped && r.MessageFilter != nil {
+			commit.Message = r.filter_message(commit.OriginalOid, commit.Message)
+			commit.MsgSize = int32(len(commit.Message))
+		}
+		if commit.Ele.Base.Dumped {
+			r.Filter.TweakCommit(commit, helper)
+		}
+		if commit.Ele.Base.Dumped && r.marks != nil {
+			commit.Message = r.rewrite_message_oids(commit.Message)
+			commit.MsgSize = int32(len(commit.Message))
+		}
+		if !commit.Ele.Base.Dumped {
+			r.Report.DroppedCommits = append(r.Report.DroppedCommits, record)
+		} else if len(commit.FileChanges) != filechanges || changed || !bytes.Equal(commit.Message, message) ||
+			commit.Author != author || commit.Commiter != commiter {
+			r.Report.RewrittenCommits = append(r.Report.RewrittenCommits, record)
+		}
+	}()
+	// 被删除且没有替代的parent(比如所有文件都被删除的first commit)会被去掉，
+	// 此时该commit成为新的first commit; 重复的parent也会被去掉
+	commit.Parents = prune_parents(commit.Parents)
+
+	// the root commits get the LFS attributes, including the empty ones,
+	// their children inherit the attributes
+	if len(commit.FileChanges) == 0 && len(commit.Parents) == 0 && len(r.LFSAttributes) != 0 {
+		changed = r.inject_attributes(commit)
+	}
+
+	// 如果没有filechange，则是empty commit，或者merge commit
+	if len(commit.FileChanges) == 0 {
+		// merge commit的其它parent都被删除了，则它也不再是merge commit
+		if len(helper.OrigParents) > 1 && len(commit.Parents) < 2 {
+			commit.Skip(commit.FirstParent())
+		}
+		return
+	}
+
+	changed = r.filter_filechange(commit)
+	if len(r.LFSAttributes) != 0 && r.inject_attributes(commit) {
+		changed = true
+	}
+	if r.LFSExport != nil && r.strip_attributes(commit) {
+		changed = true
+	}
+
+	// filechange全部被删除，则删除该commit，其children将以它的first parent作为parent
+	// 仍然有多个parent的merge commit会被保留
+	if len(commit.FileChanges) == 0 && len(commit.Parents) < 2 {
+		commit.Skip(commit.FirstParent())
+	}
+}
+
+func (r *Rewriter) filter_filechange(commit *Commit) (changed bool) {
+	newfilechanges := make([]FileChange, 0)
+	for i := range commit.FileChanges {
+		filechange := &commit.FileChanges[i]
+		// the blob this filechange refers to has been dropped, which is only
+		// known when the stream carries the blobs, in any mode
+		if filechange.ChangeType == "M" && len(filechange.BlobID) != 40 {
+			id, _ := strconv.Atoi(filechange.BlobID)
+			if !r.Session.IsDumped(int32(id)) && r.WithData {
+				r.Report.removeFile(filechange)
+				continue
+			}
+		}
+		if !r.Filter.TweakFileChange(commit, filechange) {
+			// skip this file
+			r.Report.removeFile(filechange)
+			continue
+		}
+		if len(r.PathRenames) != 0 && filechange.ChangeType != "R" {
+			path := UnquotePath(filechange.Filepath)
+			if newpath := rename_path(r.PathRenames, path); newpath != path {
+				filechange.Filepath = QuotePath(newpath)
+				changed = true
+			}
+		}
+		if filechange.ChangeType == "M" && len(filechange.BlobID) != 40 {
+			id, _ := strconv.Atoi(filechange.BlobID)
+			if r.Session.redacted_blobs[int32(id)] {
+				changed = true
+			}
+		}
+		if filechange.ChangeType == "M" && len(filechange.BlobID) == 40 {
+			r.Report.KeptBlobs[filechange.BlobID] = true
+		}
+		// otherwise, keep it in newfilechange
+		newfilechanges = append(newfilechanges, *filechange)
+	}
+	commit.FileChanges = newfilechanges
+	return changed
+}
+
+func (r *Rewriter) tweak_reset(reset *Reset) {
+	if r.Session.IsSkipped(reset.From) {
+		reset.Skip()
+	} else {
+		r.Filter.TweakReset(reset)
+	}
+	if !reset.Base.Dumped {
+		r.Report.SkippedResets = append(r.Report.SkippedResets, strings.TrimSpace(reset.Ref))
+	}
+}
+
+// a failed message filter keeps the message, rather than aborting the rewrite
+// halfway, as git-fast-import would still update the refs
+func (r *Rewriter) filter_message(oid string, msg []byte) []byte {
+	newmsg, err := r.MessageFilter.Filter(oid, msg)
+	if err != nil {
+		warn(err.Error())
+		return msg
+	}
+	return newmsg
+}
+
+// refs whose latest commits have been dropped are moved onto the replacement
+// commits, or deleted after the rewrite if nothing is left of them
+func (r *Rewriter) update_pruned_refs(output io.Writer) {
+	refs := make([]string, 0, len(r.Session.pruned_tips))
+	for ref := range r.Session.pruned_tips {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+	for _, ref := range refs {
+		if mark := r.Session.pruned_tips[ref]; mark > 0 {
+			reset := NewReset(ref, mark)
+			reset.Dump(output)
+		} else if old, ok := r.renamed_from(ref); ok {
+			// the new ref has never been written
+			r.Report.DeletedRefs = append(r.Report.DeletedRefs, old)
+		} else {
+			r.Report.DeletedRefs = append(r.Report.DeletedRefs, strings.TrimSpace(ref))
+		}
+		delete(r.Session.pruned_tips, ref)
+	}
+}
+
+// rename_ref renames the ref of a commit, reset or tag before it's dumped
+func (r *Rewriter) rename_ref(ref string) string {
+	if len(r.RefRenames) == 0 {
+		return ref
+	}
+	newref := rename_ref(r.RefRenames, ref)
+	if newref != ref {
+		r.Report.RenamedRefs[full_ref_name(ref)] = full_ref_name(newref)
+	}
+	return newref
+}
+
+// remove_renamed_refs deletes the old refs which have been renamed,
+// HEAD follows its branch to the new name
+func (r *Rewriter) remove_renamed_refs() error {
+	if head, err := r.Repo.GitCommand("symbolic-ref", "-q", "HEAD").Output(); err == nil {
+		if newref, ok := r.Report.RenamedRefs[strings.TrimSpace(string(head))]; ok {
+			if out, err := r.Repo.GitCommand("symbolic-ref", "HEAD", newref).CombinedOutput(); err != nil {
+				return fmt.Errorf("could not update HEAD to %s: %s", newref, out)
+			}
+		}
+	}
+	for old := range r.Report.RenamedRefs {
+		// another ref has been renamed to it
+		if _, ok := r.renamed_from(old); ok {
+			continue
+		}
+		if out, err := r.Repo.GitCommand("update-ref", "-d", old).CombinedOutput(); err != nil {
+			return fmt.Errorf("could not delete ref %s: %s", old, out)
+		}
+	}
+	return nil
+}
+
+// renamed_from returns the old name of a renamed ref
+func (r *Rewriter) renamed_from(ref string) (string, bool) {
+	ref = full_ref_name(ref)
+	for old, new := range r.Report.RenamedRefs {
+		if new == ref {
+			return old, true
+		}
+	}
+	return "", false
+}
+
+func (r *Rewriter) tweak_tag(tag *Tag) {
+	// the tag may have no parent, if so skip it
+	if tag.FromRef <= 0 || r.Session.IsSkipped(tag.FromRef) {
+		tag.Skip()
+	} else {
+		if r.Mailmap != nil {
+			tag.Tagger = r.Mailmap.map_user_line(tag.Tagger)
+		}
+		if r.MessageFilter != nil {
+			tag.Msg = r.filter_message(tag.OriginalOid, tag.Msg)
+			tag.MsgSize = int32(len(tag.Msg))
+		}
+		r.Filter.TweakTag(tag)
+	}
+	if tag.Ele.Base.Dumped && r.marks != nil {
+		tag.Msg = r.rewrite_message_oids(tag.Msg)
+		tag.MsgSize = int32(len(tag.Msg))
+	}
+	if !tag.Ele.Base.Dumped {
+		r.Report.SkippedTags = append(r.Report.SkippedTags, strings.TrimSpace(tag.TagName))
+	}
+}
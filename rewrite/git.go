@@ -0,0 +1,207 @@
+package rewrite
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+
+	mapset "github.com/deckarep/golang-set"
+)
+
+// Session holds the state of a single rewrite run: the OID and ID tables,
+// the skipped commits and the last commit of every branch.
+// Every run needs its own session, so that several repositories can be
+// rewritten concurrently in one process.
+type Session struct {
+	ids                Ids
+	id_hash            map[int32]string // mark id => original oid of dumped elements
+	hash_id            map[string]int32 // original oid => mark id of dumped elements
+	skipped_commits    mapset.Set
+	lasted_commit      map[string]int32
+	lasted_orig_commit map[string]int32
+	commit_oids        map[int32]string    // mark id => original oid of dumped commits
+	short_oids         map[string][]string // first 7 digits => original oids of dumped commits
+	pruned_tips        map[string]int32    // ref => replacement mark of its latest commit, which has been dropped
+	redacted_blobs     map[int32]bool      // mark ids of blobs whose data has been replaced or exported from LFS
+	attributes         map[string]string   // original .gitattributes blob => the one with LFS attributes
+}
+
+func NewSession() *Session {
+	return &Session{
+		ids:                NewIDs(),
+		id_hash:            make(map[int32]string),
+		hash_id:            make(map[string]int32),
+		skipped_commits:    mapset.NewSet(),
+		lasted_commit:      make(map[string]int32),
+		lasted_orig_commit: make(map[string]int32),
+		commit_oids:        make(map[int32]string),
+		short_oids:         make(map[string][]string),
+		pruned_tips:        make(map[string]int32),
+		redacted_blobs:     make(map[int32]bool),
+		attributes:         make(map[string]string),
+	}
+}
+
+// IsSkipped reports whether the commit with the given mark id has been dropped
+func (s *Session) IsSkipped(mark int32) bool {
+	return s.skipped_commits.Contains(mark)
+}
+
+// IsDumped reports whether the element with the given mark id has been
+// written into the fast-import stream
+func (s *Session) IsDumped(mark int32) bool {
+	_, ok := s.id_hash[mark]
+	return ok
+}
+
+// BlobOid returns the original oid of the blob a filechange refers to, it's
+// a mark id when the stream carries the blobs, or "" if the blob is unknown
+func (s *Session) BlobOid(id string) string {
+	if len(id) == 40 {
+		return id
+	}
+	mark, _ := strconv.Atoi(id)
+	return s.id_hash[int32(mark)]
+}
+
+// prune_parents removes the parents dropped without replacement,
+// and the duplicated ones, which are merged from a dropped side branch
+func prune_parents(parents []int32) []int32 {
+	pruned := make([]int32, 0, len(parents))
+	for _, parent := range parents {
+		if parent <= 0 {
+			continue
+		}
+		duplicated := false
+		for _, p := range pruned {
+			if p == parent {
+				duplicated = true
+				break
+			}
+		}
+		if !duplicated {
+			pruned = append(pruned, parent)
+		}
+	}
+	return pruned
+}
+
+/*Ids*/
+type Ids struct {
+	next_id      int32
+	translations map[int32]int32
+}
+
+// create Ids object instance
+func NewIDs() Ids {
+	return Ids{
+		next_id:      1,
+		translations: make(map[int32]int32),
+	}
+}
+
+// return current next_id, then next_id + 1
+func (ids *Ids) New() int32 {
+	id := ids.next_id
+	ids.next_id += 1
+	return id
+}
+
+// record map: old_id => new_id
+func (ids *Ids) record_rename(old_id, new_id int32) {
+	if old_id != new_id {
+		ids.translations[old_id] = new_id
+	}
+}
+
+func (ids Ids) has_renames() bool {
+	return len(ids.translations) == 0
+}
+
+// query from translations map, if find return new_id, else return old_id
+func (ids *Ids) translate(old_id int32) int32 {
+	if new_id, ok := ids.translations[old_id]; ok {
+		return new_id
+	} else {
+		return old_id
+	}
+}
+
+// Git element basically contain type and dumped field
+type GitElements struct {
+	Types  string
+	Dumped bool
+}
+
+// return element types and dump status
+func NewGitElement() GitElements {
+	return GitElements{
+		Types:  "none",
+		Dumped: true, // true means to dump out, which is the default behavior
+	}
+}
+
+func (ele *GitElements) Skip() {
+	ele.Dumped = false // false means to skip it
+}
+
+// Base represents type and dumped,
+// ID represents int32 short mark id,
+// OldID represents previous short mark id
+type GitElementsWithID struct {
+	Base    *GitElements
+	ID      int32 // mark id
+	OldID   int32 // previous mark id
+	session *Session
+}
+
+// new Git element has new mark id, and its previous id is 0 as default,
+// but will set properly on the other place
+func (s *Session) NewGitElementsWithID() GitElementsWithID {
+	ele := NewGitElement()
+	return GitElementsWithID{
+		Base:    &ele,
+		ID:      s.ids.New(),
+		OldID:   0, // mark id must > 0, so 0 just means it haven't initialized
+		session: s,
+	}
+}
+
+// Skip drops the element from the output stream, and redirects every later
+// reference to its mark onto new_id (0 means there is no replacement)
+func (ele GitElementsWithID) Skip(new_id int32) {
+	ele.Base.Dumped = false
+	if ele.OldID != 0 {
+		ele.session.ids.record_rename(ele.OldID, new_id)
+	} else {
+		ele.session.ids.record_rename(ele.ID, new_id)
+	}
+}
+
+// Repository is the Git repository a rewrite runs against
+type Repository struct {
+	GitBin  string // absolute path of the git executable
+	WorkDir string // worktree dir, or the git dir of a bare repo
+}
+
+func (repo *Repository) GitCommand(callerArgs ...string) *exec.Cmd {
+	args := []string{
+		"--no-replace-objects",
+		"-c",
+		"advice.graftFileDeprecated=false",
+		"-C",
+		repo.WorkDir,
+	}
+
+	args = append(args, callerArgs...)
+
+	cmd := exec.Command(repo.GitBin, args...)
+	cmd.Env = append(
+		os.Environ(),
+		// "GIT_DIR"+repo.gitDir, // fix Windows issue
+		// Disable grafts when running our commands:
+		"GIT_GRAFT_FILE="+os.DevNull,
+	)
+
+	return cmd
+}
@@ -0,0 +1,186 @@
+package rewrite
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// LFS_ATTRIBUTES are the attributes of the files tracked by LFS, the same as
+// written by 'git lfs track'
+const LFS_ATTRIBUTES = "filter=lfs diff=lfs merge=lfs -text"
+
+// AttributesPattern returns the .gitattributes pattern which matches exactly
+// the path: it's anchored to the root, and the special chars are escaped
+func AttributesPattern(path string) string {
+	var pattern strings.Builder
+	pattern.WriteString("/")
+	for _, c := range path {
+		switch c {
+		case ' ':
+			pattern.WriteString("[[:space:]]")
+		case '\\', '*', '?', '[', '#', '!':
+			pattern.WriteRune('\\')
+			pattern.WriteRune(c)
+		default:
+			pattern.WriteRune(c)
+		}
+	}
+	return pattern.String()
+}
+
+// merge_attributes appends the LFS attributes of the patterns which are
+// missing, the existing content is kept as it is
+func merge_attributes(content []byte, patterns []string) []byte {
+	lines := make(map[string]bool)
+	for _, line := range strings.Split(string(content), "\n") {
+		lines[strings.Join(strings.Fields(line), " ")] = true
+	}
+	merged := bytes.NewBuffer(append([]byte{}, content...))
+	if merged.Len() != 0 && !bytes.HasSuffix(content, []byte("\n")) {
+		merged.WriteString("\n")
+	}
+	for _, pattern := range patterns {
+		line := pattern + " " + LFS_ATTRIBUTES
+		if !lines[line] {
+			lines[line] = true
+			merged.WriteString(line + "\n")
+		}
+	}
+	return merged.Bytes()
+}
+
+// strip_lfs_attributes removes the lines which put the files into LFS,
+// e.g. '*.psd filter=lfs diff=lfs merge=lfs -text'
+func strip_lfs_attributes(content []byte) []byte {
+	var stripped bytes.Buffer
+	for _, line := range strings.SplitAfter(string(content), "\n") {
+		lfs := false
+		for _, attr := range strings.Fields(line) {
+			if attr == "filter=lfs" {
+				lfs = true
+			}
+		}
+		if !lfs {
+			stripped.WriteString(line)
+		}
+	}
+	return stripped.Bytes()
+}
+
+// attributes_blob returns the blob of the original .gitattributes blob,
+// which is empty for a new file, edited by edit, or "" if the result is
+// empty. The blobs are cached by the original one, a run only edits
+// .gitattributes in one way, see LFSAttributes and LFSExport.
+func (r *Rewriter) attributes_blob(original string, edit func([]byte) []byte) (string, error) {
+	if oid, ok := r.Session.attributes[original]; ok {
+		return oid, nil
+	}
+	var content []byte
+	if original != "" {
+		out, err := r.Repo.GitCommand("cat-file", "blob", original).Output()
+		if err != nil {
+			return "", fmt.Errorf("could not read .gitattributes %s: %s", original, err)
+		}
+		content = out
+	}
+	args := []string{"hash-object", "--stdin"}
+	// a dry run writes nothing into the repository
+	if !r.DryRun {
+		args = append(args, "-w")
+	}
+	content = edit(content)
+	if len(content) == 0 {
+		r.Session.attributes[original] = ""
+		return "", nil
+	}
+	cmd := r.Repo.GitCommand(args...)
+	cmd.Stdin = bytes.NewReader(content)
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("could not write .gitattributes: %s", err)
+	}
+	oid := strings.TrimSpace(string(out))
+	r.Session.attributes[original] = oid
+	return oid, nil
+}
+
+// inject_attributes adds the LFS attributes into the .gitattributes at the
+// root, where the commit adds, modifies or deletes it. The other commits
+// inherit it from their parents, except the root commits, where it's added.
+func (r *Rewriter) inject_attributes(commit *Commit) (changed bool) {
+	merge := func(content []byte) []byte {
+		return merge_attributes(content, r.LFSAttributes)
+	}
+	found := false
+	for i := range commit.FileChanges {
+		filechange := &commit.FileChanges[i]
+		if UnquotePath(filechange.Filepath) != ".gitattributes" {
+			continue
+		}
+		var original string
+		switch filechange.ChangeType {
+		case "M":
+			// not a regular file
+			if filechange.Mode == "120000" || filechange.Mode == "160000" {
+				continue
+			}
+			original = r.Session.BlobOid(filechange.BlobID)
+		case "D":
+		default:
+			continue
+		}
+		oid, err := r.attributes_blob(original, merge)
+		if err != nil {
+			warn(err.Error())
+			return changed
+		}
+		filechange.ChangeType, filechange.Mode, filechange.BlobID = "M", "100644", oid
+		found, changed = true, true
+	}
+	if !found && len(commit.Parents) == 0 {
+		oid, err := r.attributes_blob("", merge)
+		if err != nil {
+			warn(err.Error())
+			return changed
+		}
+		filechange := NewFileChange("M", "100644", oid, ".gitattributes")
+		filechange.Branch = commit.Branch
+		commit.FileChanges = append(commit.FileChanges, filechange)
+		changed = true
+	}
+	return changed
+}
+
+// strip_attributes removes the LFS attributes from every .gitattributes the
+// commit adds or modifies, it's deleted if nothing is left
+func (r *Rewriter) strip_attributes(commit *Commit) (changed bool) {
+	for i := range commit.FileChanges {
+		filechange := &commit.FileChanges[i]
+		if path.Base(UnquotePath(filechange.Filepath)) != ".gitattributes" || filechange.ChangeType != "M" ||
+			filechange.Mode == "120000" || filechange.Mode == "160000" {
+			continue
+		}
+		original := r.Session.BlobOid(filechange.BlobID)
+		// unknown blob, don't take it as an empty file
+		if original == "" {
+			continue
+		}
+		oid, err := r.attributes_blob(original, strip_lfs_attributes)
+		if err != nil {
+			warn(err.Error())
+			return changed
+		}
+		if oid == original {
+			continue
+		}
+		if oid == "" {
+			filechange.ChangeType, filechange.Mode, filechange.BlobID = "D", "", ""
+		} else {
+			filechange.BlobID = oid
+		}
+		changed = true
+	}
+	return changed
+}
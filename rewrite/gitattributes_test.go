@@ -0,0 +1,133 @@
+package rewrite
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestAttributesPattern(t *testing.T) {
+	var Data_t = []struct {
+		input    string
+		expected string
+	}{
+		{"a.psd", "/a.psd"},
+		{"assets/my file.psd", "/assets/my[[:space:]]file.psd"},
+		{"#1*?.bin", "/\\#1\\*\\?.bin"},
+		{"[a]!b.bin", "/\\[a]\\!b.bin"},
+	}
+	for _, data := range Data_t {
+		if actual := AttributesPattern(data.input); actual != data.expected {
+			t.Errorf("test AttributesPattern error: expect: %s actual: %s", data.expected, actual)
+		}
+	}
+}
+
+func TestMergeAttributes(t *testing.T) {
+	patterns := []string{"/a.psd", "*.zip"}
+	var Data_t = []struct {
+		input    string
+		expected string
+	}{
+		{"", "/a.psd filter=lfs diff=lfs merge=lfs -text\n*.zip filter=lfs diff=lfs merge=lfs -text\n"},
+		// no trailing LF
+		{"*.txt text", "*.txt text\n/a.psd filter=lfs diff=lfs merge=lfs -text\n*.zip filter=lfs diff=lfs merge=lfs -text\n"},
+		// already tracked, with different spaces
+		{"*.zip  filter=lfs diff=lfs merge=lfs -text\n", "*.zip  filter=lfs diff=lfs merge=lfs -text\n/a.psd filter=lfs diff=lfs merge=lfs -text\n"},
+	}
+	for _, data := range Data_t {
+		if actual := string(merge_attributes([]byte(data.input), patterns)); actual != data.expected {
+			t.Errorf("test merge_attributes error: expect: %q actual: %q", data.expected, actual)
+		}
+	}
+}
+
+func TestStripLFSAttributes(t *testing.T) {
+	var Data_t = []struct {
+		input    string
+		expected string
+	}{
+		{"*.psd filter=lfs diff=lfs merge=lfs -text\n", ""},
+		{"*.txt text\n/a.psd  filter=lfs diff=lfs merge=lfs -text\n*.sh eol=lf", "*.txt text\n*.sh eol=lf"},
+		{"*.txt text\n", "*.txt text\n"},
+	}
+	for _, data := range Data_t {
+		if actual := string(strip_lfs_attributes([]byte(data.input))); actual != data.expected {
+			t.Errorf("test strip_lfs_attributes error: expect: %q actual: %q", data.expected, actual)
+		}
+	}
+}
+
+func TestInjectAttributes(t *testing.T) {
+	repo := &Repository{GitBin: "git", WorkDir: t.TempDir()}
+	if out, err := repo.GitCommand("init", "--quiet").CombinedOutput(); err != nil {
+		t.Fatalf("git init error: %s %s", err, out)
+	}
+	cmd := repo.GitCommand("hash-object", "-w", "--stdin")
+	cmd.Stdin = strings.NewReader("*.txt text\n")
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("git hash-object error: %s", err)
+	}
+	attributes := strings.TrimSpace(string(out))
+
+	root := `reset refs/heads/main
+commit refs/heads/main
+mark :1
+original-oid 0e04e40bdf7cb956b36ed39b3063c253bd0d165c
+author A U Thor <author@example.com> 1633749662 +0800
+committer A U Thor <author@example.com> 1633749662 +0800
+data 6
+first
+%s
+commit refs/heads/main
+mark :2
+original-oid daca020f8360e0b2ea383e195b09b9c6a4a4979b
+author A U Thor <author@example.com> 1633749750 +0800
+committer A U Thor <author@example.com> 1633749750 +0800
+data 8
+add psd
+from :1
+M 100644 4a7c8a1f2c4e1b0a9d5b1b5e7c1b6a2d8f9e0c11 a.psd
+
+done
+`
+	var Data_t = []struct {
+		name        string
+		filechanges string
+		expected    string
+	}{
+		{"empty root", "", "*.psd filter=lfs diff=lfs merge=lfs -text\n"},
+		{"plain root", "M 100644 78981922613b2afb6025042ff6bd878ac1994e85 a.txt\n",
+			"*.psd filter=lfs diff=lfs merge=lfs -text\n"},
+		{"existing .gitattributes", "M 100644 " + attributes + " .gitattributes\n",
+			"*.txt text\n*.psd filter=lfs diff=lfs merge=lfs -text\n"},
+	}
+	for _, data := range Data_t {
+		r := &Rewriter{Repo: repo, Filter: NopFilter{}, LFSAttributes: []string{"*.psd"}}
+		var output bytes.Buffer
+		iter := NewStreamIter(NewSession(), strings.NewReader(fmt.Sprintf(root, data.filechanges)))
+		if err := r.Filtering(iter, &output); err != nil {
+			t.Fatalf("filtering error: %s", err)
+		}
+		// only the root commit carries the .gitattributes
+		var oids []string
+		for _, line := range strings.Split(output.String(), "\n") {
+			if fields := strings.Fields(line); len(fields) == 4 && fields[3] == ".gitattributes" {
+				oids = append(oids, fields[2])
+			}
+		}
+		if len(oids) != 1 || !strings.Contains(output.String(), ".gitattributes\n\ncommit") {
+			t.Errorf("test inject attributes error: %s, expect .gitattributes in the root commit only, but got:\n%s", data.name, output.String())
+			continue
+		}
+		content, err := repo.GitCommand("cat-file", "blob", oids[0]).Output()
+		if err != nil {
+			t.Fatalf("git cat-file error: %s", err)
+		}
+		if string(content) != data.expected {
+			t.Errorf("test inject attributes error: %s, expect: %q actual: %q", data.name, data.expected, content)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package rewrite
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	LFSVER = "https://git-lfs.github.com/spec/v1"
+	// pre-release version of the spec, still accepted by git-lfs
+	LFSVER_HAWSER = "https://hawser.github.com/spec/v1"
+	// a pointer file is less than 1024 bytes, bigger blobs are never pointers
+	LFS_POINTER_MAX_SIZE = 1024
+
+	lfs_key = regexp.MustCompile(`^[a-z0-9.-]+$`)
+	lfs_oid = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+)
+
+type Pointer struct {
+	Version string
+	Oid     string // sha256
+	Size    int64
+}
+
+// DecodePointer parses the blob data as a pointer file, see
+// https://github.com/git-lfs/git-lfs/blob/main/docs/spec.md:
+// every line is "key value\n", "version" comes first, and the other keys are
+// sorted, of which "oid" and "size" are required.
+func DecodePointer(data []byte) (*Pointer, error) {
+	if len(data) == 0 || len(data) >= LFS_POINTER_MAX_SIZE {
+		return nil, fmt.Errorf("not a pointer file: %d bytes", len(data))
+	}
+	if data[len(data)-1] != '\n' {
+		return nil, fmt.Errorf("not a pointer file: no trailing LF")
+	}
+	p := &Pointer{}
+	var last string
+	var has_size bool
+	for i, line := range strings.Split(string(data[:len(data)-1]), "\n") {
+		kv := strings.SplitN(line, " ", 2)
+		if len(kv) != 2 || !lfs_key.MatchString(kv[0]) {
+			return nil, fmt.Errorf("bad pointer line: %q", line)
+		}
+		key, value := kv[0], kv[1]
+		if i == 0 {
+			if key != "version" || (value != LFSVER && value != LFSVER_HAWSER) {
+				return nil, fmt.Errorf("bad pointer version: %q", line)
+			}
+			p.Version = value
+			continue
+		}
+		if key <= last {
+			return nil, fmt.Errorf("pointer keys are not sorted: %q", line)
+		}
+		last = key
+		switch key {
+		case "oid":
+			if !lfs_oid.MatchString(value) {
+				return nil, fmt.Errorf("bad pointer oid: %q", line)
+			}
+			p.Oid = strings.TrimPrefix(value, "sha256:")
+		case "size":
+			size, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || size < 0 {
+				return nil, fmt.Errorf("bad pointer size: %q", line)
+			}
+			p.Size, has_size = size, true
+		}
+	}
+	if p.Oid == "" || !has_size {
+		return nil, fmt.Errorf("pointer oid or size is missing")
+	}
+	return p, nil
+}
+
+// IsLFSPointer reports whether the blob data is a valid pointer file
+func IsLFSPointer(data []byte) bool {
+	_, err := DecodePointer(data)
+	return err == nil
+}
+
+// LFSObjectPath returns where the object of the pointer is stored, like
+// .git/lfs/objects/ab/cd/abcd...
+func LFSObjectPath(lfsdir, oid string) string {
+	return filepath.Join(lfsdir, "objects", oid[0:2], oid[2:4], oid)
+}
+
+func NewLFSPointer(blob *Blob) Pointer {
+	p := Pointer{
+		Version: LFSVER,
+		Oid:     blob.Sha256,
+		Size:    blob.DataSize,
+	}
+	return p
+}
+
+func GenerateHash(data []byte, alg string) (hash string) {
+	if alg == "sha256sum" {
+		sha256 := sha256.New()
+		sha256.Write(data)
+		return hex.EncodeToString(sha256.Sum(nil))
+	}
+	if alg == "sha1sum" {
+		sha1 := sha1.New()
+		sha1.Write(data)
+		return hex.EncodeToString(sha1.Sum(nil))
+	}
+	return
+}
+
+// version https://git-lfs.github.com/spec/v1
+// oid sha256:$(sha256)
+// size $(old size)
+func CreatePointerFile(blob *Blob) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "version %s\n", LFSVER)
+	fmt.Fprintf(&buf, "oid sha256:%s\n", blob.Sha256)
+	fmt.Fprintf(&buf, "size %d\n", blob.DataSize)
+	if buf.Len() > 200 {
+		fmt.Println("bad LFS Pointer file")
+		return nil
+	}
+	return buf.Bytes()
+}
+
+func UpdateBlob(blob *Blob) {
+	pf := CreatePointerFile(blob)
+	newblob := blob
+	newblob.OriginalOid = GenerateHash(pf, "sha1sum")
+	newblob.DataSize = int64(len(pf))
+	newblob.Data = pf
+}
+
+// LFSConverter converts the blobs it selects into LFS pointers while they
+// are parsed: the data is streamed from fast-export into the LFS storage,
+// so a large blob is never read into memory. The converted blobs are not
+// passed through Rewriter.ReplaceText.
+type LFSConverter struct {
+	// Dir is the LFS storage dir, see LFSObjectPath
+	Dir string
+	// Select reports whether the blob is converted, only its header is
+	// parsed at this point: OriginalOid and DataSize are set, Data is not.
+	Select func(blob *Blob) bool
+}
+
+// read_lfs_blob streams the data of the blob into the LFS object file, and
+// replaces the data by the pointer. Nothing is written if lfsdir is empty,
+// e.g. in a dry run, the data is only hashed then. A blob which is already
+// a pointer is kept as it is.
+func (iter *FEOutPutIter) read_lfs_blob(blob *Blob, lfsdir string) error {
+	var data io.Reader = io.LimitReader(iter.f, blob.DataSize)
+	if blob.DataSize < int64(LFS_POINTER_MAX_SIZE) {
+		if err := iter.read_blob_data(blob); err != nil {
+			return err
+		}
+		if IsLFSPointer(blob.Data) {
+			return nil
+		}
+		data = bytes.NewReader(blob.Data)
+	}
+
+	hash := sha256.New()
+	var f *os.File
+	var writer io.Writer = hash
+	if lfsdir != "" {
+		// objects are written into a temp file first, like git-lfs does,
+		// so that an interrupted write won't leave a broken object
+		tmpdir := filepath.Join(lfsdir, "tmp")
+		if err := os.MkdirAll(tmpdir, 0777); err != nil {
+			return fmt.Errorf("create directory error: %s", err)
+		}
+		var err error
+		if f, err = ioutil.TempFile(tmpdir, blob.OriginalOid); err != nil {
+			return fmt.Errorf("create file error: %s", err)
+		}
+		defer os.Remove(f.Name())
+		writer = io.MultiWriter(f, hash)
+	}
+	n, err := io.Copy(writer, data)
+	if err == nil && n != blob.DataSize {
+		err = io.ErrUnexpectedEOF
+	}
+	if f != nil {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("read blob %s error: %s", blob.OriginalOid, err)
+	}
+	blob.Sha256 = hex.EncodeToString(hash.Sum(nil))
+
+	if f != nil {
+		file := LFSObjectPath(lfsdir, blob.Sha256)
+		// the same content has been converted before
+		if _, err := os.Stat(file); os.IsNotExist(err) {
+			if err := os.MkdirAll(filepath.Dir(file), 0777); err != nil {
+				return fmt.Errorf("create directory error: %s", err)
+			}
+			// TempFile is only readable by the owner
+			if err := os.Chmod(f.Name(), 0644); err != nil {
+				return err
+			}
+			if err := os.Rename(f.Name(), file); err != nil {
+				return fmt.Errorf("write data into %s error: %s", file, err)
+			}
+		}
+	}
+	blob.Data = nil
+	UpdateBlob(blob)
+	return nil
+}
+
+// LFSExporter replaces LFS pointers by the objects they point to, which is
+// the reverse of LFSConverter. The objects are copied from the LFS storage
+// when the blobs are dumped, so a large one is never read into memory. The
+// exported blobs are not passed through Rewriter.ReplaceText.
+type LFSExporter struct {
+	// Dir is the LFS storage dir, see LFSObjectPath
+	Dir string
+}
+
+// LFSObject is an LFS pointer blob and the object it points to
+type LFSObject struct {
+	Blob    string // original oid of the pointer blob
+	Pointer Pointer
+}
+
+// export_lfs_blob replaces the blob by the object it points to, if it's
+// a pointer whose object is in the LFS storage
+func (r *Rewriter) export_lfs_blob(blob *Blob) {
+	if blob.DataSize >= int64(LFS_POINTER_MAX_SIZE) {
+		return
+	}
+	pointer, err := DecodePointer(blob.Data)
+	if err != nil {
+		return
+	}
+	file := LFSObjectPath(r.LFSExport.Dir, pointer.Oid)
+	// an object of another size is broken, e.g. an interrupted download
+	if info, err := os.Stat(file); err != nil || info.Size() != pointer.Size {
+		r.Report.MissingLFSObjects = append(r.Report.MissingLFSObjects, LFSObject{blob.OriginalOid, *pointer})
+		return
+	}
+	blob.Data, blob.DataSize, blob.DataFile, blob.Sha256 = nil, pointer.Size, file, pointer.Oid
+	r.Session.redacted_blobs[blob.Ele.ID] = true
+	r.Report.ExportedBlobs = append(r.Report.ExportedBlobs, blob.OriginalOid)
+}
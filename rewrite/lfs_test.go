@@ -0,0 +1,166 @@
+package rewrite
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDecodePointer(t *testing.T) {
+	oid := "4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393"
+	var Data_t = []struct {
+		input    string
+		expected *Pointer
+	}{
+		{"version https://git-lfs.github.com/spec/v1\noid sha256:" + oid + "\nsize 12345\n",
+			&Pointer{LFSVER, oid, 12345}},
+		{"version https://hawser.github.com/spec/v1\next-0-foo sha256:" + oid + "\noid sha256:" + oid + "\nsize 0\n",
+			&Pointer{LFSVER_HAWSER, oid, 0}},
+		// no trailing LF
+		{"version https://git-lfs.github.com/spec/v1\noid sha256:" + oid + "\nsize 12345", nil},
+		// keys are not sorted
+		{"version https://git-lfs.github.com/spec/v1\nsize 12345\noid sha256:" + oid + "\n", nil},
+		// size is missing
+		{"version https://git-lfs.github.com/spec/v1\noid sha256:" + oid + "\n", nil},
+		{"version https://git-lfs.github.com/spec/v1\noid sha256:1234\nsize 12345\n", nil},
+		{"oid sha256:" + oid + "\nsize 12345\n", nil},
+		{"just a text file\n", nil},
+		{"", nil},
+	}
+	for _, data := range Data_t {
+		actual, err := DecodePointer([]byte(data.input))
+		if data.expected == nil {
+			if err == nil {
+				t.Errorf("test DecodePointer error: expect an error for %q", data.input)
+			}
+			continue
+		}
+		if err != nil || *actual != *data.expected {
+			t.Errorf("test DecodePointer error: expect: %v actual: %v, %v", data.expected, actual, err)
+		}
+	}
+}
+
+func TestLFSConverter(t *testing.T) {
+	lfsdir := t.TempDir()
+	r := &Rewriter{
+		Filter:   NopFilter{},
+		WithData: true,
+		LFS: &LFSConverter{
+			Dir: lfsdir,
+			Select: func(blob *Blob) bool {
+				return blob.OriginalOid == "4a7c8a1f2c4e1b0a9d5b1b5e7c1b6a2d8f9e0c11"
+			},
+		},
+	}
+	var output bytes.Buffer
+	iter := NewStreamIter(NewSession(), strings.NewReader(testStream))
+	if err := r.Filtering(iter, &output); err != nil {
+		t.Fatalf("filtering error: %s", err)
+	}
+	oid := GenerateHash([]byte("big\n"), "sha256sum")
+	pointer := "version " + LFSVER + "\noid sha256:" + oid + "\nsize 4\n"
+	out := output.String()
+	if !strings.Contains(out, fmt.Sprintf("data %d\n%s\n", len(pointer), pointer)) {
+		t.Errorf("expect big.bin to be converted into the pointer, but got:\n%s", out)
+	}
+	if !strings.Contains(out, "data 2\na\n\n") {
+		t.Errorf("expect a.txt to be kept, but got:\n%s", out)
+	}
+	data, err := ioutil.ReadFile(LFSObjectPath(lfsdir, oid))
+	if err != nil || string(data) != "big\n" {
+		t.Errorf("expect the LFS object to be written, but got: %q, %v", data, err)
+	}
+}
+
+func TestLFSExporter(t *testing.T) {
+	lfsdir := t.TempDir()
+	oid := GenerateHash([]byte("big\n"), "sha256sum")
+	missing := GenerateHash([]byte("missing\n"), "sha256sum")
+	object := LFSObjectPath(lfsdir, oid)
+	if err := os.MkdirAll(filepath.Dir(object), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(object, []byte("big\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	pointer := func(oid string, size int) string {
+		data := fmt.Sprintf("version %s\noid sha256:%s\nsize %d\n", LFSVER, oid, size)
+		return fmt.Sprintf("data %d\n%s\n", len(data), data)
+	}
+	stream := `blob
+mark :1
+original-oid 78981922613b2afb6025042ff6bd878ac1994e85
+` + pointer(oid, 4) + `
+blob
+mark :2
+original-oid 4a7c8a1f2c4e1b0a9d5b1b5e7c1b6a2d8f9e0c11
+` + pointer(missing, 8) + `
+reset refs/heads/main
+commit refs/heads/main
+mark :3
+original-oid 0e04e40bdf7cb956b36ed39b3063c253bd0d165c
+author A U Thor <author@example.com> 1633749662 +0800
+committer A U Thor <author@example.com> 1633749662 +0800
+data 6
+first
+M 100644 :1 big.bin
+M 100644 :2 missing.bin
+
+done
+`
+	r := &Rewriter{
+		Filter:    NopFilter{},
+		WithData:  true,
+		LFSExport: &LFSExporter{Dir: lfsdir},
+	}
+	var output bytes.Buffer
+	iter := NewStreamIter(NewSession(), strings.NewReader(stream))
+	if err := r.Filtering(iter, &output); err != nil {
+		t.Fatalf("filtering error: %s", err)
+	}
+	out := output.String()
+	if !strings.Contains(out, "original-oid 78981922613b2afb6025042ff6bd878ac1994e85\ndata 4\nbig\n") {
+		t.Errorf("expect big.bin to be exported, but got:\n%s", out)
+	}
+	if !strings.Contains(out, pointer(missing, 8)) {
+		t.Errorf("expect the pointer of missing.bin to be kept, but got:\n%s", out)
+	}
+	if len(r.Report.MissingLFSObjects) != 1 || r.Report.MissingLFSObjects[0].Pointer.Oid != missing {
+		t.Errorf("expect the object of missing.bin to be reported, but got: %+v", r.Report.MissingLFSObjects)
+	}
+	if len(r.Report.RewrittenCommits) != 1 {
+		t.Errorf("expect commit 'first' to be rewritten, but got: %+v", r.Report.RewrittenCommits)
+	}
+}
+
+func TestDumpBlobDataFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "whole"), []byte("big\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "short"), []byte("bi"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// the size of the data has been written, a short file breaks the stream
+	var Data_t = []struct {
+		file     string
+		expected bool
+	}{
+		{"whole", true},
+		{"short", false},
+		{"missing", false},
+	}
+	for _, data := range Data_t {
+		blob := NewSession().NewBlob(4, nil, "78981922613b2afb6025042ff6bd878ac1994e85", "")
+		blob.DataFile = filepath.Join(dir, data.file)
+		var output bytes.Buffer
+		if err := blob.Dump(&output); (err == nil) != data.expected {
+			t.Errorf("test dump blob error: %s expect dumped: %v, but got: %v", data.file, data.expected, err)
+		}
+	}
+}
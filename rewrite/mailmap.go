@@ -0,0 +1,155 @@
+package rewrite
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+/*
+Mailmap rewrites names and emails of authors, committers and taggers,
+see git-check-mailmap(1) for the format:
+
+	Proper Name <commit@email>
+	<proper@email> <commit@email>
+	Proper Name <proper@email> <commit@email>
+	Proper Name <proper@email> Commit Name <commit@email>
+
+Emails and names are matched case-insensitively, an entry with the commit
+name takes precedence over the one without it.
+*/
+type Mailmap struct {
+	entries map[string]mailmap_entry // lower "commit-name <commit-email>" or "<commit-email>" => entry
+}
+
+type mailmap_entry struct {
+	name  string // empty means to keep the name
+	email string // empty means to keep the email
+}
+
+func NewMailmap() *Mailmap {
+	return &Mailmap{entries: make(map[string]mailmap_entry)}
+}
+
+func mailmap_key(name, email string) string {
+	if name == "" {
+		return strings.ToLower("<" + email + ">")
+	}
+	return strings.ToLower(name + " <" + email + ">")
+}
+
+// split "Name <email>" into name and email, returns the rest after '>'
+func split_ident(s string) (name, email, rest string, ok bool) {
+	start := strings.IndexByte(s, '<')
+	end := strings.IndexByte(s, '>')
+	if start < 0 || end < start {
+		return "", "", s, false
+	}
+	return strings.TrimSpace(s[:start]), strings.TrimSpace(s[start+1 : end]), s[end+1:], true
+}
+
+// like git, entries of the same commit identity are merged,
+// e.g. the name comes from one entry and the email from another one
+func (m *Mailmap) add(key string, entry mailmap_entry) {
+	old := m.entries[key]
+	if entry.name == "" {
+		entry.name = old.name
+	}
+	if entry.email == "" {
+		entry.email = old.email
+	}
+	m.entries[key] = entry
+}
+
+// Parse reads mailmap entries, later entries override earlier ones
+func (m *Mailmap) Parse(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		proper_name, proper_email, rest, ok := split_ident(line)
+		if !ok {
+			return fmt.Errorf("invalid mailmap entry: %s", line)
+		}
+		commit_name, commit_email, _, ok := split_ident(rest)
+		if !ok {
+			// Proper Name <commit@email>
+			m.add(mailmap_key("", proper_email), mailmap_entry{name: proper_name})
+			continue
+		}
+		m.add(mailmap_key(commit_name, commit_email), mailmap_entry{name: proper_name, email: proper_email})
+	}
+	return scanner.Err()
+}
+
+func ReadMailmap(path string) (*Mailmap, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	m := NewMailmap()
+	return m, m.Parse(f)
+}
+
+// ReadRepoMailmap reads the .mailmap file in HEAD, which works in bare repos too,
+// returns an empty mailmap if there is none
+func (repo *Repository) ReadRepoMailmap() (*Mailmap, error) {
+	m := NewMailmap()
+	out, err := repo.GitCommand("cat-file", "blob", "HEAD:.mailmap").Output()
+	if err != nil {
+		return m, nil
+	}
+	return m, m.Parse(bytes.NewReader(out))
+}
+
+// Merge adds the entries of other, which override the existing ones
+func (m *Mailmap) Merge(other *Mailmap) {
+	for key, entry := range other.entries {
+		m.add(key, entry)
+	}
+}
+
+// Map returns the proper name and email
+func (m *Mailmap) Map(name, email string) (string, string) {
+	entry, ok := m.entries[mailmap_key(name, email)]
+	if !ok {
+		entry, ok = m.entries[mailmap_key("", email)]
+	}
+	if !ok {
+		return name, email
+	}
+	if entry.name != "" {
+		name = entry.name
+	}
+	if entry.email != "" {
+		email = entry.email
+	}
+	return name, email
+}
+
+// map_user_line rewrites the identity of line like
+// "author Name <email> 1633964331 +0800\n"
+func (m *Mailmap) map_user_line(line string) string {
+	i := strings.IndexByte(line, ' ')
+	if i < 0 {
+		return line
+	}
+	name, email, rest, ok := split_ident(line[i+1:])
+	if !ok {
+		return line
+	}
+	new_name, new_email := m.Map(name, email)
+	if new_name == name && new_email == email {
+		return line
+	}
+	return line[:i+1] + new_name + " <" + new_email + ">" + rest
+}
@@ -0,0 +1,35 @@
+package rewrite
+
+import (
+	"strings"
+	"testing"
+)
+
+const testMailmap = `# comment
+Proper Name <old@example.com>
+<proper@example.com> <old@example.com>
+Other Name <other@example.com> Commit Name <commit@example.com>
+<ceo@example.com> <CEO@Example.com> # trailing comment
+`
+
+func TestMailmap(t *testing.T) {
+	var Data_t = []struct {
+		input    string
+		expected string
+	}{
+		{"author Old <old@example.com> 1633749662 +0800\n", "author Proper Name <proper@example.com> 1633749662 +0800\n"},
+		{"committer Commit Name <commit@example.com> 1633749662 +0800\n", "committer Other Name <other@example.com> 1633749662 +0800\n"},
+		{"committer Someone Else <commit@example.com> 1633749662 +0800\n", "committer Someone Else <commit@example.com> 1633749662 +0800\n"},
+		{"tagger Boss <ceo@EXAMPLE.com> 1633749662 +0800\n", "tagger Boss <ceo@example.com> 1633749662 +0800\n"},
+		{"author Nobody <nobody@example.com> 1633749662 +0800\n", "author Nobody <nobody@example.com> 1633749662 +0800\n"},
+	}
+	m := NewMailmap()
+	if err := m.Parse(strings.NewReader(testMailmap)); err != nil {
+		t.Fatalf("parse mailmap error: %s", err)
+	}
+	for _, data := range Data_t {
+		if actual := m.map_user_line(data.input); actual != data.expected {
+			t.Errorf("test Mailmap error: expect: %q actual: %q", data.expected, actual)
+		}
+	}
+}
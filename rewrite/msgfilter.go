@@ -0,0 +1,85 @@
+package rewrite
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// MessageFilter rewrites commit and tag messages, the steps run in order:
+// replace rules, trailer stripping, then the external command.
+type MessageFilter struct {
+	// Rules have the same syntax as ReplaceText, e.g. 'regex:JIRA-(\d+)==>#${1}'
+	Rules []*ReplaceRule
+	// Trailers are the keys of trailers to strip, e.g. "Change-Id",
+	// matched case-insensitively in the last paragraph of the message
+	Trailers []string
+	// Command is run by the shell for every message, it receives the message
+	// on stdin and prints the new one, GIT_COMMIT is set to the original oid
+	Command string
+}
+
+// Filter returns the new message, the message is kept if the command fails
+func (f *MessageFilter) Filter(oid string, msg []byte) ([]byte, error) {
+	if len(f.Rules) != 0 {
+		msg, _ = replace_text(f.Rules, msg)
+	}
+	if len(f.Trailers) != 0 {
+		msg = strip_trailers(msg, f.Trailers)
+	}
+	if f.Command != "" {
+		var cmd *exec.Cmd
+		if runtime.GOOS == "windows" {
+			cmd = exec.Command("cmd", "/C", f.Command)
+		} else {
+			cmd = exec.Command("sh", "-c", f.Command)
+		}
+		cmd.Env = append(os.Environ(), "GIT_COMMIT="+oid)
+		cmd.Stdin = bytes.NewReader(msg)
+		cmd.Stderr = os.Stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return msg, fmt.Errorf("message filter command failed on %s: %s", oid, err)
+		}
+		msg = out
+	}
+	return msg, nil
+}
+
+// strip_trailers removes trailers like "Change-Id: I1234" from the last
+// paragraph, and the paragraph itself if nothing is left
+func strip_trailers(msg []byte, keys []string) []byte {
+	text := string(msg)
+	body := strings.TrimRight(text, "\n")
+	start := strings.LastIndex(body, "\n\n")
+	if start < 0 {
+		// a message of a single paragraph has no trailer
+		return msg
+	}
+	var kept []string
+	for _, line := range strings.Split(body[start+2:], "\n") {
+		stripped := false
+		for _, key := range keys {
+			if len(line) > len(key) && strings.EqualFold(line[:len(key)], key) && line[len(key)] == ':' {
+				stripped = true
+				break
+			}
+		}
+		if !stripped {
+			kept = append(kept, line)
+		}
+	}
+
+	result := body[:start]
+	if len(kept) != 0 {
+		result += "\n\n" + strings.Join(kept, "\n")
+	}
+	// keep the line break at the end
+	if strings.HasSuffix(text, "\n") {
+		result += "\n"
+	}
+	return []byte(result)
+}
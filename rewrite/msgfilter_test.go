@@ -0,0 +1,23 @@
+package rewrite
+
+import (
+	"testing"
+)
+
+func TestStripTrailers(t *testing.T) {
+	var Data_t = []struct {
+		input    string
+		expected string
+	}{
+		{"subject\n\nbody\n\nChange-Id: I1234\nSigned-off-by: A <a@b.c>\n", "subject\n\nbody\n\nSigned-off-by: A <a@b.c>\n"},
+		{"subject\n\nchange-id: I1234\n", "subject\n"},
+		{"subject\n\nChange-Id: I1234", "subject"},
+		{"Change-Id: I1234\n", "Change-Id: I1234\n"},
+		{"subject\n\nChange-Ids are useful\n", "subject\n\nChange-Ids are useful\n"},
+	}
+	for _, data := range Data_t {
+		if actual := string(strip_trailers([]byte(data.input), []string{"Change-Id"})); actual != data.expected {
+			t.Errorf("test strip_trailers error: expect: %q actual: %q", data.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package rewrite
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// full or abbreviated(at least 7 hex digits) object ids in commit and tag messages
+var oid_in_msg_re = regexp.MustCompile(`\b[0-9a-f]{7,40}\b`)
+
+// markQuerier asks the running git-fast-import for the new oid of a mark,
+// by 'get-mark' commands. The responses are read from its stdout.
+type markQuerier struct {
+	input   io.Writer
+	answers *bufio.Reader
+	cache   map[int32]string
+}
+
+func newMarkQuerier(input io.Writer, output io.Reader) *markQuerier {
+	return &markQuerier{
+		input:   input,
+		answers: bufio.NewReader(output),
+		cache:   make(map[int32]string),
+	}
+}
+
+func (q *markQuerier) query(mark int32) (string, error) {
+	if oid, ok := q.cache[mark]; ok {
+		return oid, nil
+	}
+	if _, err := fmt.Fprintf(q.input, "get-mark :%d\n", mark); err != nil {
+		return "", err
+	}
+	line, err := q.answers.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	oid := strings.TrimSpace(line)
+	if len(oid) != 40 {
+		return "", fmt.Errorf("unexpected get-mark response: %s", oid)
+	}
+	q.cache[mark] = oid
+	return oid, nil
+}
+
+// find the mark of an already dumped commit by its full or abbreviated original oid,
+// returns 0 if there's none or the abbreviation is ambiguous
+func (s *Session) commit_mark(oid string) int32 {
+	if len(oid) == 40 {
+		if mark, ok := s.hash_id[oid]; ok && s.commit_oids[mark] == oid {
+			return mark
+		}
+		return 0
+	}
+	var found int32
+	for _, full := range s.short_oids[oid[:7]] {
+		if strings.HasPrefix(full, oid) {
+			if found != 0 {
+				// ambiguous
+				return 0
+			}
+			found = s.hash_id[full]
+		}
+	}
+	return found
+}
+
+// replace the original oids referenced by a message with the rewritten ones,
+// abbreviated oids keep their length
+func (r *Rewriter) rewrite_message_oids(msg []byte) []byte {
+	return oid_in_msg_re.ReplaceAllFunc(msg, func(oid []byte) []byte {
+		mark := r.Session.commit_mark(string(oid))
+		if mark == 0 {
+			return oid
+		}
+		new_oid, err := r.marks.query(mark)
+		if err != nil {
+			warn(fmt.Sprintf("query new oid of %s error: %s", oid, err))
+			return oid
+		}
+		return []byte(new_oid[:len(oid)])
+	})
+}
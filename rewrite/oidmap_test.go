@@ -0,0 +1,33 @@
+package rewrite
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestRewriteMessageOids(t *testing.T) {
+	s := NewSession()
+	commit := s.NewCommit("0e04e40bdf7cb956b36ed39b3063c253bd0d165c", " refs/heads/main", "", "", 0, nil, nil, nil)
+	commit.Dump(ioutil.Discard)
+
+	r := &Rewriter{
+		Session: s,
+		// the answer of 'get-mark' from git-fast-import
+		marks: newMarkQuerier(ioutil.Discard, strings.NewReader("daca020f8360e0b2ea383e195b09b9c6a4a4979b\n")),
+	}
+	var Data_t = []struct {
+		input    string
+		expected string
+	}{
+		{"Reverts 0e04e40bdf7cb956b36ed39b3063c253bd0d165c\n", "Reverts daca020f8360e0b2ea383e195b09b9c6a4a4979b\n"},
+		{"Reverts 0e04e40\n", "Reverts daca020\n"},
+		{"unknown 1234567\n", "unknown 1234567\n"},
+	}
+	for _, data := range Data_t {
+		actual := string(r.rewrite_message_oids([]byte(data.input)))
+		if actual != data.expected {
+			t.Errorf("test rewrite_message_oids error: expect: %q actual: %q", data.expected, actual)
+		}
+	}
+}
@@ -1,15 +1,14 @@
-package main
+package rewrite
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"regexp"
 	"strconv"
 	"strings"
-
-	mapset "github.com/deckarep/golang-set"
 )
 
 const (
@@ -19,19 +18,16 @@ const (
 	ref_re  = `(.*)\n$`               // commit|reset|tag refs/tags/v1.0.0
 )
 
-var (
-	HASH_ID            = make(map[string]int32)
-	SKIPPED_COMMITS    = mapset.NewSet()
-	Lasted_commit      = make(map[string]int32)
-	Lasted_orig_commit = make(map[string]int32)
-)
+// ErrNestedTags is returned when the fast-export stream contains a tag of a tag,
+// which git-fast-import can't replay when several refs are rewritten at once.
+var ErrNestedTags = errors.New("nested tags are not supported")
 
 type origParents []int32
 type hasFilechange bool
 
-type Helper_info struct {
-	orig_parents   origParents
-	has_filechange hasFilechange
+type HelperInfo struct {
+	OrigParents   origParents
+	HasFilechange hasFilechange
 }
 
 func Match(pattern string, str string) []string {
@@ -39,6 +35,11 @@ func Match(pattern string, str string) []string {
 	return re.FindStringSubmatch(str)
 }
 
+// report a malformed fast-export line, the stream is still parsed on a best effort basis
+func warn(msg string) {
+	fmt.Fprintln(os.Stderr, msg)
+}
+
 /*
 blob
 mark :1
@@ -47,38 +48,69 @@ data 9
 "file a"
 */
 type Blob struct {
-	ele          *GitElementsWithID // contain: id, old_id, types, dumped
-	original_oid string             // 40 bytes
-	data_size    int64              // blob size maybe very large
-	data         []byte             // raw data block
-	sha256       string             // for lfs objects
+	Ele         *GitElementsWithID // contain: id, old_id, types, dumped
+	OriginalOid string             // 40 bytes
+	DataSize    int64              // blob size maybe very large
+	Data        []byte             // raw data block
+	Sha256      string             // oid of the LFS object, set once converted into or exported from LFS
+	DataFile    string             // the data is copied from this file instead of Data when dumped, e.g. an LFS object
 }
 
-func NewBlob(size_ int64, data_ []byte, hash_id_, sha256_ string) Blob {
-	var ele = NewGitElementsWithID()
-	ele.base.types = "blob"
+func (s *Session) NewBlob(size_ int64, data_ []byte, hash_id_, sha256_ string) Blob {
+	var ele = s.NewGitElementsWithID()
+	ele.Base.Types = "blob"
 	return Blob{
-		ele:          &ele,
-		original_oid: hash_id_,
-		data_size:    size_,
-		data:         data_,
-		sha256:       sha256_,
+		Ele:         &ele,
+		OriginalOid: hash_id_,
+		DataSize:    size_,
+		Data:        data_,
+		Sha256:      sha256_,
 	}
 }
 
-func (blob Blob) dump(writer io.WriteCloser) {
-	blob.ele.base.dumped = true
-	HASH_ID[blob.original_oid] = blob.ele.id
-	ID_HASH[blob.ele.id] = blob.original_oid
+// Dump writes the blob into writer. git-fast-import has been told the size
+// of the data, so the stream is broken if the data can't be written.
+func (blob *Blob) Dump(writer io.Writer) error {
+	blob.Ele.Base.Dumped = true
+	blob.Ele.session.hash_id[blob.OriginalOid] = blob.Ele.ID
+	blob.Ele.session.id_hash[blob.Ele.ID] = blob.OriginalOid
 
-	mark_line := fmt.Sprintf("mark :%d\n", blob.ele.id)
-	oid_line := fmt.Sprintf("original-oid %s\n", blob.original_oid)
-	data_line := fmt.Sprintf("data %d\n%s\n", blob.data_size, blob.data)
+	mark_line := fmt.Sprintf("mark :%d\n", blob.Ele.ID)
+	oid_line := fmt.Sprintf("original-oid %s\n", blob.OriginalOid)
+	data_line := fmt.Sprintf("data %d\n", blob.DataSize)
 
 	writer.Write([]byte("blob\n"))
 	writer.Write([]byte(mark_line))
 	writer.Write([]byte(oid_line))
 	writer.Write([]byte(data_line))
+	// the data may be large, don't copy it
+	if blob.DataFile != "" {
+		if err := copy_file(writer, blob.DataFile, blob.DataSize); err != nil {
+			return fmt.Errorf("dump blob %s error: %s", blob.OriginalOid, err)
+		}
+	} else if _, err := writer.Write(blob.Data); err != nil {
+		return fmt.Errorf("dump blob %s error: %s", blob.OriginalOid, err)
+	}
+	_, err := writer.Write([]byte("\n"))
+	return err
+}
+
+// copy exactly size bytes of the file into writer
+func copy_file(writer io.Writer, file string, size int64) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := io.CopyN(writer, f, size); err != nil {
+		return fmt.Errorf("read %s error: %s", file, err)
+	}
+	return nil
+}
+
+// Skip drops the blob, filechanges which refer to it will be dropped too
+func (blob *Blob) Skip() {
+	blob.Ele.Skip(0)
 }
 
 /*
@@ -105,17 +137,19 @@ mode specification:
 when the mode is "040000", the id must be 40-byte HASH-1 value, but not short mark id
 
 filechange can compose together :
+
 	D A
 	M 100644 :16 dir/B
+
 this means rename a file and move it from another location
 */
 type FileChange struct {
-	base       *GitElements
-	changetype string
-	mode       string
-	blob_id    string
-	filepath   string
-	branch     string // record branch(ref) name this filechange belongs to
+	Base       *GitElements
+	ChangeType string
+	Mode       string
+	BlobID     string
+	Filepath   string
+	Branch     string // record branch(ref) name this filechange belongs to
 }
 
 // **NOTE**
@@ -124,45 +158,44 @@ type FileChange struct {
 // filechange usually have multi-line
 func NewFileChange(types_, mode_, id_, filepath_ string) FileChange {
 	var base = NewGitElement()
-	base.types = "filechange"
+	base.Types = "filechange"
 	return FileChange{
-		base:       &base,
-		changetype: types_,
-		mode:       mode_,
-		blob_id:    id_,
-		filepath:   filepath_,
+		Base:       &base,
+		ChangeType: types_,
+		Mode:       mode_,
+		BlobID:     id_,
+		Filepath:   filepath_,
 	}
 }
 
-func (fc *FileChange) dump(writer io.WriteCloser) {
-	if fc.changetype == "M" && fc.blob_id == "0" {
+func (fc *FileChange) Dump(writer io.Writer) {
+	if fc.ChangeType == "M" && fc.BlobID == "0" {
 		return
 	}
-	fc.base.dumped = true
-	if fc.changetype == "M" {
-		if len(fc.blob_id) == 40 {
-			filechange_ := fmt.Sprintf("M %s %s %s\n", fc.mode, fc.blob_id, fc.filepath)
+	fc.Base.Dumped = true
+	if fc.ChangeType == "M" {
+		if len(fc.BlobID) == 40 {
+			filechange_ := fmt.Sprintf("M %s %s %s\n", fc.Mode, fc.BlobID, fc.Filepath)
 			writer.Write([]byte(filechange_))
 		} else {
-			filechange_ := fmt.Sprintf("M %s :%s %s\n", fc.mode, fc.blob_id, fc.filepath)
+			filechange_ := fmt.Sprintf("M %s :%s %s\n", fc.Mode, fc.BlobID, fc.Filepath)
 			writer.Write([]byte(filechange_))
 		}
-	} else if fc.changetype == "D" {
-		filechange_ := fmt.Sprintf("D %s\n", fc.filepath)
+	} else if fc.ChangeType == "D" {
+		filechange_ := fmt.Sprintf("D %s\n", fc.Filepath)
 		writer.Write([]byte(filechange_))
-	} else if fc.changetype == "R" {
+	} else if fc.ChangeType == "R" {
 		// **NOTE** if we don't add '-M' in git-fast-export, then it will use 'M' and 'D' to represent 'R'
 		// filepath_ := fmt.Sprintf("R %s %s\n", fc.old-path, new-path)
 		// writer.Write([]byte(filepath_))
 	} else {
 		// unhandle filechange type
-		PrintLocalWithRedln("unsupported filechange type")
+		warn("unsupported filechange type: " + fc.ChangeType)
 		return
 	}
 }
 
 /*
-
 commit refs/heads/4
 mark :25
 original-oid daca020f8360e0b2ea383e195b09b9c6a4a4979b
@@ -191,95 +224,101 @@ c). When merge multi branches into one, a commit have multi parents, then there
 c). When a commit has parent commit, then it has from or merge(or both), otherwise, have none of them.
 */
 type Commit struct {
-	ele          *GitElementsWithID // mark id
-	old_id       int32              // previous mark id, given by GitElementsWithID
-	original_oid string
-	branch       string
-	author       string
-	commiter     string
-	msg_size     int32
-	message      []byte       // commit message
-	parents      []int32      // from and merge. from maybe none, and merge maybe multi
-	filechanges  []FileChange // multi-line
-}
-
-func NewCommit(original_oid_, branch_, author_, commiter_ string, size_ int32, msg_ []byte, parents_ []int32, filechanges_ []FileChange) Commit {
-	var ele = NewGitElementsWithID()
-	ele.base.types = "commit"
+	Ele         *GitElementsWithID // mark id
+	OldID       int32              // previous mark id, given by GitElementsWithID
+	OriginalOid string
+	Branch      string
+	Author      string
+	Commiter    string
+	MsgSize     int32
+	Message     []byte       // commit message
+	Parents     []int32      // from and merge. from maybe none, and merge maybe multi
+	FileChanges []FileChange // multi-line
+}
+
+func (s *Session) NewCommit(original_oid_, branch_, author_, commiter_ string, size_ int32, msg_ []byte, parents_ []int32, filechanges_ []FileChange) Commit {
+	var ele = s.NewGitElementsWithID()
+	ele.Base.Types = "commit"
 	return Commit{
-		ele:          &ele,
-		old_id:       ele.id,
-		original_oid: original_oid_,
-		branch:       branch_,
-		author:       author_,
-		commiter:     commiter_,
-		msg_size:     size_,
-		message:      msg_,
-		parents:      parents_,
-		filechanges:  filechanges_,
+		Ele:         &ele,
+		OldID:       ele.ID,
+		OriginalOid: original_oid_,
+		Branch:      branch_,
+		Author:      author_,
+		Commiter:    commiter_,
+		MsgSize:     size_,
+		Message:     msg_,
+		Parents:     parents_,
+		FileChanges: filechanges_,
 	}
 }
 
-func (commit *Commit) dump(writer io.WriteCloser) {
-	commit.ele.base.dumped = true
+func (commit *Commit) Dump(writer io.Writer) {
+	commit.Ele.Base.Dumped = true
 
-	HASH_ID[commit.original_oid] = commit.ele.id
-	ID_HASH[commit.ele.id] = commit.original_oid
+	commit.Ele.session.hash_id[commit.OriginalOid] = commit.Ele.ID
+	commit.Ele.session.id_hash[commit.Ele.ID] = commit.OriginalOid
+	commit.Ele.session.commit_oids[commit.Ele.ID] = commit.OriginalOid
+	if len(commit.OriginalOid) == 40 {
+		short := commit.OriginalOid[:7]
+		commit.Ele.session.short_oids[short] = append(commit.Ele.session.short_oids[short], commit.OriginalOid)
+	}
 
-	commit_line := fmt.Sprintf("commit%s\n", commit.branch)
-	mark_line := fmt.Sprintf("mark :%d\n", commit.ele.id)
-	orig_id := fmt.Sprintf("original-oid %s\n", commit.original_oid)
+	commit_line := fmt.Sprintf("commit%s\n", commit.Branch)
+	mark_line := fmt.Sprintf("mark :%d\n", commit.Ele.ID)
+	orig_id := fmt.Sprintf("original-oid %s\n", commit.OriginalOid)
 
 	writer.Write([]byte(commit_line))
 	writer.Write([]byte(mark_line))
 	writer.Write([]byte(orig_id))
 
-	if len(commit.author) != 0 {
-		author_line := commit.author
+	if len(commit.Author) != 0 {
+		author_line := commit.Author
 		writer.Write([]byte(author_line))
 	}
-	if len(commit.commiter) != 0 {
-		commiter_line := commit.commiter
+	if len(commit.Commiter) != 0 {
+		commiter_line := commit.Commiter
 		writer.Write([]byte(commiter_line))
 	}
 
-	size_line := fmt.Sprintf("data %d\n", commit.msg_size)
-	data_line := commit.message
+	size_line := fmt.Sprintf("data %d\n", commit.MsgSize)
+	data_line := commit.Message
 	writer.Write([]byte(size_line))
 	writer.Write([]byte(data_line))
 
-	if len(commit.parents) > 0 {
-		from_line := fmt.Sprintf("from :%d\n", commit.parents[0])
+	if len(commit.Parents) > 0 {
+		from_line := fmt.Sprintf("from :%d\n", commit.Parents[0])
 		writer.Write([]byte(from_line))
 	}
-	if len(commit.parents) > 1 {
-		for _, merge := range commit.parents[1:] {
+	if len(commit.Parents) > 1 {
+		for _, merge := range commit.Parents[1:] {
 			parent_line := fmt.Sprintf("merge :%d\n", merge)
 			writer.Write([]byte(parent_line))
 		}
 	}
 	// **NOTE** the filechanges here are multi-string line
-	for _, filechange := range commit.filechanges {
-		filechange.dump(writer)
+	for _, filechange := range commit.FileChanges {
+		filechange.Dump(writer)
 	}
 
 	writer.Write([]byte("\n"))
 }
 
-func (commit *Commit) first_parent() int32 {
-	if len(commit.parents) > 0 {
-		return commit.parents[0]
+func (commit *Commit) FirstParent() int32 {
+	if len(commit.Parents) > 0 {
+		return commit.Parents[0]
 	}
 	return 0
 }
 
-func (commit *Commit) skip(new_id int32) {
-	if commit.old_id != 0 {
-		SKIPPED_COMMITS.Add(commit.old_id)
+// Skip drops the commit, its children will take new_id as their parent instead
+func (commit *Commit) Skip(new_id int32) {
+	if commit.OldID != 0 {
+		commit.Ele.session.skipped_commits.Add(commit.OldID)
 	} else {
-		SKIPPED_COMMITS.Add(commit.ele.id)
+		commit.Ele.session.skipped_commits.Add(commit.Ele.ID)
 	}
-	commit.ele.skip(new_id)
+	commit.Ele.Skip(new_id)
 }
 
 /*
@@ -287,32 +326,36 @@ reset refs/heads/main
 from :12
 */
 type Reset struct {
-	base *GitElements
-	ref  string
-	from int32
+	Base *GitElements
+	Ref  string
+	From int32
 }
 
 func NewReset(ref_ string, from_ref_ int32) Reset {
 	base := NewGitElement()
-	base.types = "reset"
+	base.Types = "reset"
 	return Reset{
-		base: &base,
-		ref:  ref_,      // ref is string
-		from: from_ref_, // but from_ref is short mark id, optional exist
+		Base: &base,
+		Ref:  ref_,      // ref is string
+		From: from_ref_, // but from_ref is short mark id, optional exist
 	}
 }
 
-func (r *Reset) dump(writer io.WriteCloser) {
-	r.base.dumped = true
-	ref_line := fmt.Sprintf("reset%s\n", r.ref)
+func (r *Reset) Dump(writer io.Writer) {
+	r.Base.Dumped = true
+	ref_line := fmt.Sprintf("reset%s\n", r.Ref)
 	writer.Write([]byte(ref_line))
-	if r.from > 0 {
-		from_ref_line := fmt.Sprintf("from :%d\n", r.from)
+	if r.From > 0 {
+		from_ref_line := fmt.Sprintf("from :%d\n", r.From)
 		writer.Write([]byte(from_ref_line))
 		writer.Write([]byte("\n"))
 	}
 }
 
+func (r *Reset) Skip() {
+	r.Base.Skip()
+}
+
 /*
 tag v1.0.1
 mark :13
@@ -327,42 +370,42 @@ tagger的格式为：<tagger_name> SP <tagger_email> SP <tagger_date>
 tag 内容为数据块，大小固定(e.g. data 11，指定大小为11), 不包含LF
 */
 type Tag struct {
-	ele          *GitElementsWithID // mark_id, old_id, types, dumped
-	old_id       int32              // mark_id too
-	tag_name     string             // tag name(ref) line: tag v1.0.1, tag refs/heads/main
-	from_ref     int32              // from :id line
-	original_oid string
-	tagger       string // tagger line
-	msg_size     int32  // tager size is not as large as blob's
-	msg          []byte // message line, raw bytes
-}
-
-func NewTag(tag_name_ string, from_ref_ int32, original_oid_, tagger_ string, size_ int32, msg_ []byte) Tag {
-	ele := NewGitElementsWithID()
-	ele.base.types = "tag"
+	Ele         *GitElementsWithID // mark_id, old_id, types, dumped
+	OldID       int32              // mark_id too
+	TagName     string             // tag name(ref) line: tag v1.0.1, tag refs/heads/main
+	FromRef     int32              // from :id line
+	OriginalOid string
+	Tagger      string // tagger line
+	MsgSize     int32  // tager size is not as large as blob's
+	Msg         []byte // message line, raw bytes
+}
+
+func (s *Session) NewTag(tag_name_ string, from_ref_ int32, original_oid_, tagger_ string, size_ int32, msg_ []byte) Tag {
+	ele := s.NewGitElementsWithID()
+	ele.Base.Types = "tag"
 	return Tag{
-		ele:          &ele,
-		old_id:       ele.id, // old_id = current mark id
-		tag_name:     tag_name_,
-		from_ref:     from_ref_,     // parent mark id
-		original_oid: original_oid_, // sha-1 id
-		tagger:       tagger_,
-		msg_size:     size_,
-		msg:          msg_,
+		Ele:         &ele,
+		OldID:       ele.ID, // old_id = current mark id
+		TagName:     tag_name_,
+		FromRef:     from_ref_,     // parent mark id
+		OriginalOid: original_oid_, // sha-1 id
+		Tagger:      tagger_,
+		MsgSize:     size_,
+		Msg:         msg_,
 	}
 }
 
-func (tag *Tag) dump(writer io.WriteCloser) {
-	tag.ele.base.dumped = true
-	HASH_ID[tag.original_oid] = tag.ele.id
-	ID_HASH[tag.ele.id] = tag.original_oid
+func (tag *Tag) Dump(writer io.Writer) {
+	tag.Ele.Base.Dumped = true
+	tag.Ele.session.hash_id[tag.OriginalOid] = tag.Ele.ID
+	tag.Ele.session.id_hash[tag.Ele.ID] = tag.OriginalOid
 
-	tag_line := fmt.Sprintf("tag%s\n", tag.tag_name)
-	mark_line := fmt.Sprintf("mark :%d\n", tag.ele.id)
-	from_line := fmt.Sprintf("from :%d\n", tag.from_ref)
-	origin_oid := fmt.Sprintf("original-oid %s\n", tag.original_oid)
-	tagger_line := tag.tagger
-	data_line := fmt.Sprintf("data %d\n%s\n", tag.msg_size, tag.msg)
+	tag_line := fmt.Sprintf("tag%s\n", tag.TagName)
+	mark_line := fmt.Sprintf("mark :%d\n", tag.Ele.ID)
+	from_line := fmt.Sprintf("from :%d\n", tag.FromRef)
+	origin_oid := fmt.Sprintf("original-oid %s\n", tag.OriginalOid)
+	tagger_line := tag.Tagger
+	data_line := fmt.Sprintf("data %d\n%s\n", tag.MsgSize, tag.Msg)
 
 	writer.Write([]byte(tag_line))
 	writer.Write([]byte(mark_line))
@@ -372,6 +415,10 @@ func (tag *Tag) dump(writer io.WriteCloser) {
 	writer.Write([]byte(data_line))
 }
 
+func (tag *Tag) Skip() {
+	tag.Ele.Skip(0)
+}
+
 // ref_line are like:
 // commit refs/xxx/
 // reset refs/xxx/
@@ -391,29 +438,28 @@ func parse_ref_line(reftype, line string) (refname string) {
 // from :parent_ref_id
 // merge :parent_ref_id
 // parent ref types are: from or merge
-func parse_parent_ref(reftype, line string) (orig_ref, ref int32) {
+func (s *Session) parse_parent_ref(reftype, line string) (orig_ref, ref int32, err error) {
 	matches := Match(reftype+" :"+ref_re, line)
 	// from 0000000000000000000000000000000000000000
 	if len(line) == 46 && line[5:len(line)-1] == "0000000000000000000000000000000000000000" {
 		// mark to delete
-		PrintLocalWithRedln("nested tags error")
-		os.Exit(1)
+		return 0, 0, ErrNestedTags
 	}
 	if len(matches) == 0 {
 		// don't matched parent ref line
-		return 0, 0
+		return 0, 0, nil
 	}
 	orig_baseref := matches[1]
 	origref, _ := strconv.Atoi(orig_baseref)
-	baseref := IDs.translate(int32(origref))
+	baseref := s.ids.translate(int32(origref))
 	// return ref mark id, not the whole line
-	return int32(origref), baseref
+	return int32(origref), baseref, nil
 }
 
 func parse_mark(line string) (idx int32) {
 	matches := Match("mark :"+idx_re, line)
 	if len(matches) == 0 {
-		PrintLocalWithRedln("no match mark id")
+		warn("no match mark id")
 		return 0
 	}
 	if idx, err := strconv.Atoi(matches[1]); err == nil {
@@ -425,7 +471,7 @@ func parse_mark(line string) (idx int32) {
 func parse_original_oid(line string) (oid string) {
 	matches := Match("original-oid "+oid_re, line)
 	if len(matches) == 0 {
-		PrintLocalWithRedln("no match original-oid")
+		warn("no match original-oid")
 		return ""
 	}
 	// single oid string
@@ -435,7 +481,7 @@ func parse_original_oid(line string) (oid string) {
 func parse_datasize(line string) int64 {
 	matches := Match("data "+idx_re, line)
 	if len(matches) == 0 {
-		PrintLocalWithRedln("no match data size")
+		warn("no match data size")
 		return -1
 	}
 	size, err := strconv.ParseInt(matches[1], 10, 64)
@@ -460,7 +506,7 @@ func parse_user(usertype, line string) (use string) {
 
 // file mode can be: M(modify), D(delete), C(copy), R(rename), A(add)
 // here we only handle M,D and R mode
-func parse_filechange(line string) FileChange {
+func (s *Session) parse_filechange(line string) FileChange {
 	arr := strings.Split(line, " ")
 	types := arr[0]
 	if types == "M" { // pattern: M mode :id path
@@ -470,7 +516,7 @@ func parse_filechange(line string) FileChange {
 		if strings.HasPrefix(arr[2], ":") {
 			parent_id = arr[2][1:]
 			orig, _ := strconv.Atoi(parent_id)
-			IDs.translate(int32(orig))
+			s.ids.translate(int32(orig))
 		} else { // pattern: M mode hash1-id path
 			parent_id = arr[2]
 		}
@@ -483,7 +529,7 @@ func parse_filechange(line string) FileChange {
 		return filechange
 	} else if types == "D" { // pattern: D path
 		path := strings.Join(arr[1:], " ")
-		path = strings.TrimSuffix(arr[1], "\n")
+		path = strings.TrimSuffix(path, "\n")
 		filechange := NewFileChange("D", "", "", path)
 		return filechange
 	} else if types == "R" { // pattern: R old new
@@ -500,7 +546,9 @@ func parse_filechange(line string) FileChange {
 // **NOTE**
 // blob data size maybe zero, so the parsed data matches maybe like:
 // [data 0
-//  0]
+//
+//	0]
+//
 // thus we use -1 to indicate parse error
 func (iter *FEOutPutIter) parse_data(line string, size int64) (n int64, data, extra_msg []byte) {
 	var writer bytes.Buffer
@@ -510,10 +558,10 @@ func (iter *FEOutPutIter) parse_data(line string, size int64) (n int64, data, ex
 	for size != 0 {
 		n, err := writer.Write([]byte(newline))
 		if err != nil {
-			PrintRedln(fmt.Sprint(err))
+			warn(fmt.Sprint(err))
 		}
 		if n != len(newline) {
-			PrintLocalWithRedln("failed to write data")
+			warn("failed to write data")
 		}
 		sum += int64(n)
 		if sum == size {
@@ -530,7 +578,20 @@ func (iter *FEOutPutIter) parse_data(line string, size int64) (n int64, data, ex
 	return sum, writer.Bytes(), extra_msg
 }
 
-func (iter *FEOutPutIter) parseBlob(line string) *Blob {
+func (iter *FEOutPutIter) ParseBlob(line string) *Blob {
+	blob := iter.parse_blob_header(line)
+	if blob.Ele == nil {
+		return blob
+	}
+	if err := iter.read_blob_data(blob); err != nil {
+		warn(fmt.Sprintf("parse blob error: %s", err))
+	}
+	return blob
+}
+
+// parse_blob_header parses the blob up to the 'data' line, the data is
+// left in the stream, see read_blob_data and read_lfs_blob
+func (iter *FEOutPutIter) parse_blob_header(line string) *Blob {
 	// go to next line
 	newline, _ := iter.Next()
 
@@ -550,21 +611,27 @@ func (iter *FEOutPutIter) parseBlob(line string) *Blob {
 	newline, _ = iter.Next()
 	size := parse_datasize(newline)
 
-	newline, _ = iter.Next()
-	_, data_block, _ := iter.parse_data(newline, size)
-
-	sha256 := GenerateHash(data_block, "sha256sum")
-
-	blob := NewBlob(size, data_block, original_oid, sha256)
+	blob := iter.session.NewBlob(size, nil, original_oid, "")
 
 	if mark_id > 0 {
-		blob.ele.old_id = mark_id
-		IDs.record_rename(mark_id, blob.ele.id)
+		blob.Ele.OldID = mark_id
+		iter.session.ids.record_rename(mark_id, blob.Ele.ID)
 	}
 	return &blob
 }
 
-func (iter *FEOutPutIter) parseCommit(line string) (*Commit, *Helper_info) {
+// read_blob_data reads exactly DataSize bytes of the blob data, the data
+// is binary, it may have no newline at all
+func (iter *FEOutPutIter) read_blob_data(blob *Blob) error {
+	if blob.DataSize <= 0 {
+		return nil
+	}
+	blob.Data = make([]byte, blob.DataSize)
+	_, err := io.ReadFull(iter.f, blob.Data)
+	return err
+}
+
+func (iter *FEOutPutIter) ParseCommit(line string) (*Commit, *HelperInfo, error) {
 	if line == "\n" {
 		line, _ = iter.Next()
 	}
@@ -573,8 +640,7 @@ func (iter *FEOutPutIter) parseCommit(line string) (*Commit, *Helper_info) {
 	newline, _ := iter.Next()
 	mark_id := parse_mark(newline)
 	if mark_id == 0 {
-		PrintLocalWithRedln("no match mark id")
-		return &Commit{}, &Helper_info{}
+		return &Commit{}, &HelperInfo{}, nil
 	}
 
 	newline, _ = iter.Next()
@@ -620,8 +686,11 @@ func (iter *FEOutPutIter) parseCommit(line string) (*Commit, *Helper_info) {
 
 		if match := Match("from :"+ref_re, string(tail_msg)); len(match) > 0 {
 			// get a from parent in extra_msg
-			// must use parse_parent_ref() method to parse it, otherwise will get a dump error in some case.
-			old_id, from_id := parse_parent_ref("from", string(tail_msg))
+			// must use iter.session.parse_parent_ref() method to parse it, otherwise will get a dump error in some case.
+			old_id, from_id, err := iter.session.parse_parent_ref("from", string(tail_msg))
+			if err != nil {
+				return nil, nil, err
+			}
 			orig_parents = append(orig_parents, old_id)
 			parents = append(parents, from_id)
 			used = true
@@ -636,24 +705,30 @@ func (iter *FEOutPutIter) parseCommit(line string) (*Commit, *Helper_info) {
 
 	// from parent
 	if strings.HasPrefix(newline, "from") {
-		old_id, from_id := parse_parent_ref("from", newline)
+		old_id, from_id, err := iter.session.parse_parent_ref("from", newline)
+		if err != nil {
+			return nil, nil, err
+		}
 		orig_parents = append(orig_parents, old_id)
 		parents = append(parents, from_id)
 		newline, _ = iter.Next()
 	}
 	// merge parents
 	for strings.HasPrefix(newline, "merge") {
-		old_id, merge_id := parse_parent_ref("merge", newline)
+		old_id, merge_id, err := iter.session.parse_parent_ref("merge", newline)
+		if err != nil {
+			return nil, nil, err
+		}
 		orig_parents = append(orig_parents, old_id)
 		parents = append(parents, merge_id)
 		newline, _ = iter.Next()
 	}
 
-	if n := len(orig_parents); n == 0 && Lasted_commit[branch] > 0 {
-		parents = []int32{Lasted_commit[branch]}
+	if n := len(orig_parents); n == 0 && iter.session.lasted_commit[branch] > 0 {
+		parents = []int32{iter.session.lasted_commit[branch]}
 	}
-	if n := len(orig_parents); n == 0 && Lasted_orig_commit[branch] > 0 {
-		orig_parents = []int32{Lasted_orig_commit[branch]}
+	if n := len(orig_parents); n == 0 && iter.session.lasted_orig_commit[branch] > 0 {
+		orig_parents = []int32{iter.session.lasted_orig_commit[branch]}
 	}
 
 	// parse filechanges
@@ -662,68 +737,72 @@ func (iter *FEOutPutIter) parseCommit(line string) (*Commit, *Helper_info) {
 
 	// if extra_msg is not empty and haven't been used, treat it as filechange
 	if len(tail_msg) > 1 && !used {
-		filechange = parse_filechange(string(tail_msg))
-		filechange.branch = branch
+		filechange = iter.session.parse_filechange(string(tail_msg))
+		filechange.Branch = branch
 		file_changes = append(file_changes, filechange)
 	}
 	for newline != "\n" {
-		filechange = parse_filechange(newline)
-		filechange.branch = branch
+		filechange = iter.session.parse_filechange(newline)
+		filechange.Branch = branch
 		file_changes = append(file_changes, filechange)
 		newline, _ = iter.Next()
 	}
 
-	commit := NewCommit(original_oid, branch, author, commiter, int32(len(msg)),
+	commit := iter.session.NewCommit(original_oid, branch, author, commiter, int32(len(msg)),
 		msg, parents, file_changes)
 
 	if mark_id > 0 {
-		commit.old_id = mark_id
-		IDs.record_rename(mark_id, commit.ele.id)
+		commit.OldID = mark_id
+		iter.session.ids.record_rename(mark_id, commit.Ele.ID)
 	}
 
-	hinfo := &Helper_info{
-		orig_parents:   orig_parents,
-		has_filechange: len(commit.filechanges) != 0,
+	hinfo := &HelperInfo{
+		OrigParents:   orig_parents,
+		HasFilechange: len(commit.FileChanges) != 0,
 	}
 
-	return &commit, hinfo
+	return &commit, hinfo, nil
 }
 
-func (iter *FEOutPutIter) parseReset(line string) *Reset {
+func (iter *FEOutPutIter) ParseReset(line string) (*Reset, error) {
 	ref := parse_ref_line("reset", line)
 	// this reset is the first reset on the first commit
 	str, _ := iter.f.Peek(6)
 	if string(str) == "commit" {
 		reset := NewReset(ref, 0)
-		return &reset
+		return &reset, nil
 	}
 	// then countinue to parse from-line in reset structure
 	newline, _ := iter.Next()
-	_, parent_id := parse_parent_ref("from", newline)
+	_, parent_id, err := iter.session.parse_parent_ref("from", newline)
+	if err != nil {
+		return nil, err
+	}
 
 	if parent_id <= 0 {
-		delete(Lasted_commit, ref)
-		delete(Lasted_orig_commit, ref)
+		delete(iter.session.lasted_commit, ref)
+		delete(iter.session.lasted_orig_commit, ref)
 	}
 	reset := NewReset(ref, parent_id)
 
-	Lasted_commit[reset.ref] = reset.from
-	Lasted_orig_commit[reset.ref] = reset.from
+	iter.session.lasted_commit[reset.Ref] = reset.From
+	iter.session.lasted_orig_commit[reset.Ref] = reset.From
 
-	return &reset
+	return &reset, nil
 }
 
-func (iter *FEOutPutIter) parseTag(line string) *Tag {
+func (iter *FEOutPutIter) ParseTag(line string) (*Tag, error) {
 	tag_name := parse_ref_line("tag", line)
 
 	// go to next new line
 	newline, _ := iter.Next()
 	mark_id := parse_mark(newline)
-	if mark_id == 0 {
-		PrintLocalWithRedln("no match mark id")
-	}
+
 	newline, _ = iter.Next()
-	_, parent_id := parse_parent_ref("from", newline)
+	_, parent_id, err := iter.session.parse_parent_ref("from", newline)
+	if err != nil {
+		return nil, err
+	}
 
 	newline, _ = iter.Next()
 	original_oid := parse_original_oid(newline)
@@ -737,84 +816,17 @@ func (iter *FEOutPutIter) parseTag(line string) *Tag {
 	newline, _ = iter.Next()
 	actual_size, msg, _ := iter.parse_data(newline, size)
 
-	tag := NewTag(tag_name, parent_id, original_oid, tagger, int32(actual_size), msg)
+	tag := iter.session.NewTag(tag_name, parent_id, original_oid, tagger, int32(actual_size), msg)
 
 	// the parsed mark id from original source data is old id,
-	// cause the new id is generated by IDs.New() in NewTag()
+	// cause the new id is generated by session.ids.New() in NewTag()
 	if mark_id > 0 {
 		// new_id = tag.ele.id
-		tag.old_id = mark_id
+		tag.OldID = mark_id
 		// map[old_id] = to new_id
-		IDs.record_rename(mark_id, tag.ele.id)
+		iter.session.ids.record_rename(mark_id, tag.Ele.ID)
 	} else {
-		tag.ele.skip(0)
-	}
-	return &tag
-}
-
-func (repo *Repository) Parser() {
-	if repo.context.opts.verbose {
-		if repo.context.opts.lfs {
-			PrintLocalWithGreenln("start to migrate specified files")
-		} else {
-			PrintLocalWithGreenln("start to clean up specified files")
-		}
-	}
-
-	iter, err := repo.NewFastExportIter()
-	if err != nil {
-		fmt.Fprint(os.Stdout, err)
-	}
-	defer iter.Close()
-
-	input, cmd, err := repo.FastImportOut()
-	defer func() {
-		input.Close()
-		cmd.Wait()
-	}()
-	if err != nil {
-		PrintLocalWithRedln("run git-fast-import process failed")
-	}
-
-	for {
-		line, _ := iter.Next()
-		if matches := Match("feature done\n$", line); len(matches) != 0 {
-			continue
-		} else if matches := Match("^blob\n$", line); len(matches) != 0 {
-			blob := iter.parseBlob(line)
-			repo.tweak_blob(blob)
-
-			if blob.ele.base.dumped {
-				blob.dump(input)
-			}
-
-		} else if matches := Match("commit (.*)\n$", line); len(matches) != 0 {
-			commit, aux_info := iter.parseCommit(line)
-			repo.tweak_commit(commit, aux_info)
-
-			if commit.ele.base.dumped {
-				commit.dump(input)
-			}
-
-		} else if matches := Match("reset (.*)\n$", line); len(matches) != 0 {
-			reset := iter.parseReset(line)
-
-			repo.tweak_reset(reset)
-
-			if reset.base.dumped {
-				reset.dump(input)
-			}
-		} else if matches := Match("tag (.*)\n$", line); len(matches) != 0 {
-			tag := iter.parseTag(line)
-
-			repo.tweak_tag(tag)
-
-			if tag.ele.base.dumped {
-				tag.dump(input)
-			}
-		} else if matches := Match("done\n$", line); len(matches) != 0 {
-			iter.Close()
-			break
-		}
+		tag.Ele.Skip(0)
 	}
+	return &tag, nil
 }
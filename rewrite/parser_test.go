@@ -0,0 +1,224 @@
+package rewrite
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testStream = `feature done
+blob
+mark :1
+original-oid 78981922613b2afb6025042ff6bd878ac1994e85
+data 2
+a
+
+blob
+mark :2
+original-oid 4a7c8a1f2c4e1b0a9d5b1b5e7c1b6a2d8f9e0c11
+data 4
+big
+
+reset refs/heads/main
+commit refs/heads/main
+mark :3
+original-oid 0e04e40bdf7cb956b36ed39b3063c253bd0d165c
+author A U Thor <author@example.com> 1633749662 +0800
+committer A U Thor <author@example.com> 1633749662 +0800
+data 6
+first
+M 100644 :1 a.txt
+
+commit refs/heads/main
+mark :4
+original-oid daca020f8360e0b2ea383e195b09b9c6a4a4979b
+author A U Thor <author@example.com> 1633749750 +0800
+committer A U Thor <author@example.com> 1633749750 +0800
+data 8
+add big
+from :3
+M 100644 :2 big.bin
+
+done
+`
+
+type dropBlob struct {
+	NopFilter
+	oid string
+}
+
+func (f dropBlob) TweakBlob(blob *Blob) {
+	if blob.OriginalOid == f.oid {
+		blob.Skip()
+	}
+}
+
+func TestFiltering(t *testing.T) {
+	// every run owns its session, so they can run at the same time
+	for _, name := range []string{"first run", "second run"} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			r := &Rewriter{
+				Filter:   dropBlob{oid: "4a7c8a1f2c4e1b0a9d5b1b5e7c1b6a2d8f9e0c11"},
+				WithData: true,
+			}
+			var output bytes.Buffer
+			iter := NewStreamIter(NewSession(), strings.NewReader(testStream))
+			if err := r.Filtering(iter, &output); err != nil {
+				t.Fatalf("filtering error: %s", err)
+			}
+			out := output.String()
+			if strings.Contains(out, "big.bin") || strings.Contains(out, "add big") {
+				t.Errorf("dropped blob and commit should not be dumped, but got:\n%s", out)
+			}
+			if !strings.Contains(out, "M 100644 :1 a.txt\n") {
+				t.Errorf("expect file a.txt to be kept, but got:\n%s", out)
+			}
+			// the tip of main has been dropped, main is moved onto its parent
+			if !strings.HasSuffix(out, "reset refs/heads/main\nfrom :3\n\n") {
+				t.Errorf("expect main to be reset to :3, but got:\n%s", out)
+			}
+			if !r.Session.IsSkipped(4) {
+				t.Errorf("expect commit :4 to be skipped")
+			}
+			if len(r.Report.DroppedCommits) != 1 || r.Report.DroppedCommits[0].Subject != "add big" {
+				t.Errorf("expect commit 'add big' to be reported as dropped, but got: %+v", r.Report.DroppedCommits)
+			}
+			if r.Report.FreedBytes != 4 {
+				t.Errorf("expect 4 bytes to be freed, but got: %d", r.Report.FreedBytes)
+			}
+		})
+	}
+}
+
+type keepPath struct {
+	NopFilter
+	path string
+}
+
+func (f keepPath) TweakFileChange(commit *Commit, filechange *FileChange) bool {
+	return filechange.Filepath == f.path
+}
+
+func TestPruneRootCommit(t *testing.T) {
+	r := &Rewriter{Filter: keepPath{path: "big.bin"}}
+	var output bytes.Buffer
+	iter := NewStreamIter(NewSession(), strings.NewReader(testStream))
+	if err := r.Filtering(iter, &output); err != nil {
+		t.Fatalf("filtering error: %s", err)
+	}
+	out := output.String()
+	// the root commit is dropped, its child becomes the new root commit
+	if strings.Contains(out, "first") || strings.Contains(out, "from :") {
+		t.Errorf("expect commit 'first' to be dropped without a replacement, but got:\n%s", out)
+	}
+	if !strings.Contains(out, "add big\nM 100644 :2 big.bin\n") {
+		t.Errorf("expect commit 'add big' to be kept as root commit, but got:\n%s", out)
+	}
+}
+
+func TestParseFilechange(t *testing.T) {
+	var Data_t = []struct {
+		input    string
+		expected FileChange
+	}{
+		{"M 100644 :18 files/1.c\n", FileChange{ChangeType: "M", Mode: "100644", BlobID: "18", Filepath: "files/1.c"}},
+		{"M 100644 :18 bad dir/2.c\n", FileChange{ChangeType: "M", Mode: "100644", BlobID: "18", Filepath: "bad dir/2.c"}},
+		{"D output\n", FileChange{ChangeType: "D", Filepath: "output"}},
+	}
+	s := NewSession()
+	for _, data := range Data_t {
+		actual := s.parse_filechange(data.input)
+		if actual.ChangeType != data.expected.ChangeType || actual.Mode != data.expected.Mode ||
+			actual.BlobID != data.expected.BlobID || actual.Filepath != data.expected.Filepath {
+			t.Errorf("test parse_filechange error: expect: %+v actual: %+v", data.expected, actual)
+		}
+	}
+}
+
+type dropPath struct {
+	NopFilter
+	path string
+}
+
+func (f dropPath) TweakFileChange(commit *Commit, filechange *FileChange) bool {
+	return filechange.Filepath != f.path
+}
+
+func TestFreedBlobs(t *testing.T) {
+	// without data, filechanges refer to oids, the same blob is at a.bin and b.bin
+	stream := `reset refs/heads/main
+commit refs/heads/main
+mark :1
+original-oid 0e04e40bdf7cb956b36ed39b3063c253bd0d165c
+author A U Thor <author@example.com> 1633749662 +0800
+committer A U Thor <author@example.com> 1633749662 +0800
+data 6
+first
+M 100644 78981922613b2afb6025042ff6bd878ac1994e85 a.bin
+M 100644 78981922613b2afb6025042ff6bd878ac1994e85 b.bin
+M 100644 4a7c8a1f2c4e1b0a9d5b1b5e7c1b6a2d8f9e0c11 c.bin
+
+done
+`
+	var Data_t = []struct {
+		path     string
+		expected []string
+	}{
+		{"a.bin", nil},
+		{"c.bin", []string{"4a7c8a1f2c4e1b0a9d5b1b5e7c1b6a2d8f9e0c11"}},
+	}
+	for _, data := range Data_t {
+		r := &Rewriter{Filter: dropPath{path: data.path}}
+		var output bytes.Buffer
+		iter := NewStreamIter(NewSession(), strings.NewReader(stream))
+		if err := r.Filtering(iter, &output); err != nil {
+			t.Fatalf("filtering error: %s", err)
+		}
+		if actual := r.Report.FreedBlobs(); !reflect.DeepEqual(actual, data.expected) {
+			t.Errorf("test FreedBlobs error: drop %s, expect: %v actual: %v", data.path, data.expected, actual)
+		}
+	}
+}
+
+func TestDroppedBlobMarks(t *testing.T) {
+	// the blob :1 is not in the stream, as if it has been dropped
+	stream := `reset refs/heads/main
+commit refs/heads/main
+mark :2
+original-oid 0e04e40bdf7cb956b36ed39b3063c253bd0d165c
+author A U Thor <author@example.com> 1633749662 +0800
+committer A U Thor <author@example.com> 1633749662 +0800
+data 6
+first
+M 100644 :1 a.bin
+M 100644 78981922613b2afb6025042ff6bd878ac1994e85 b.bin
+
+done
+`
+	// the marks of dropped blobs are only known when the stream carries data
+	var Data_t = []struct {
+		withData bool
+		expected bool
+	}{
+		{true, false},
+		{false, true},
+	}
+	for _, data := range Data_t {
+		r := &Rewriter{Filter: NopFilter{}, WithData: data.withData}
+		var output bytes.Buffer
+		iter := NewStreamIter(NewSession(), strings.NewReader(stream))
+		if err := r.Filtering(iter, &output); err != nil {
+			t.Fatalf("filtering error: %s", err)
+		}
+		out := output.String()
+		if actual := strings.Contains(out, "M 100644 :1 a.bin\n"); actual != data.expected {
+			t.Errorf("test dropped blob marks error: WithData: %v, expect a.bin kept: %v, but got:\n%s", data.withData, data.expected, out)
+		}
+		if !strings.Contains(out, "b.bin") {
+			t.Errorf("expect b.bin to be kept, but got:\n%s", out)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package rewrite
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PathRename moves a file or a directory to another place, an empty Old means
+// the root of the repository, and an empty New promotes Old to the root
+type PathRename struct {
+	Old string
+	New string
+}
+
+// ParsePathRename parses rule like "OLD:NEW"
+func ParsePathRename(rule string) (PathRename, error) {
+	i := strings.LastIndex(rule, ":")
+	if i < 0 {
+		return PathRename{}, fmt.Errorf("invalid path rename %s, should be OLD:NEW", rule)
+	}
+	rename := PathRename{
+		Old: strings.Trim(rule[:i], "/"),
+		New: strings.Trim(rule[i+1:], "/"),
+	}
+	if rename.Old == rename.New {
+		return PathRename{}, fmt.Errorf("invalid path rename %s, OLD and NEW are the same", rule)
+	}
+	return rename, nil
+}
+
+// Rename returns the new path, or false if the path is not under Old
+func (rename PathRename) Rename(path string) (string, bool) {
+	var rest string
+	if rename.Old == "" {
+		rest = path
+	} else if strings.HasPrefix(path, rename.Old+"/") {
+		rest = path[len(rename.Old)+1:]
+	} else if path == rename.Old && rename.New != "" {
+		return rename.New, true
+	} else {
+		return path, false
+	}
+	if rename.New == "" {
+		return rest, true
+	}
+	return rename.New + "/" + rest, true
+}
+
+// rename the path by every matched rule in order
+func rename_path(renames []PathRename, path string) string {
+	for _, rename := range renames {
+		path, _ = rename.Rename(path)
+	}
+	return path
+}
+
+// QuotePath is the reverse of UnquotePath, the path is C-style quoted only
+// if git-fast-import can't read it as is
+func QuotePath(path string) string {
+	quoted := false
+	for i := 0; i < len(path); i++ {
+		if path[i] < 0x20 || path[i] == '"' || path[i] == '\\' {
+			quoted = true
+			break
+		}
+	}
+	if !quoted {
+		return path
+	}
+	var buf strings.Builder
+	buf.WriteByte('"')
+	for i := 0; i < len(path); i++ {
+		switch c := path[i]; c {
+		case '"', '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			if c < 0x20 {
+				fmt.Fprintf(&buf, "\\%03o", c)
+			} else {
+				buf.WriteByte(c)
+			}
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
@@ -0,0 +1,41 @@
+package rewrite
+
+import (
+	"testing"
+)
+
+func TestRenamePath(t *testing.T) {
+	var Data_t = []struct {
+		rules    []string
+		path     string
+		expected string
+	}{
+		{[]string{"old:new"}, "old/a.c", "new/a.c"},
+		{[]string{"old:new"}, "old", "new"},
+		{[]string{"old:new"}, "older/a.c", "older/a.c"},
+		{[]string{"sub/:"}, "sub/dir/a.c", "dir/a.c"},
+		{[]string{":sub"}, "dir/a.c", "sub/dir/a.c"},
+		{[]string{"a:b", "b:c"}, "a/x", "c/x"},
+	}
+	for _, data := range Data_t {
+		var renames []PathRename
+		for _, rule := range data.rules {
+			rename, err := ParsePathRename(rule)
+			if err != nil {
+				t.Fatalf("test ParsePathRename error: %s", err)
+			}
+			renames = append(renames, rename)
+		}
+		if actual := rename_path(renames, data.path); actual != data.expected {
+			t.Errorf("test rename_path error: %v on %s expect: %v actual: %v", data.rules, data.path, data.expected, actual)
+		}
+	}
+}
+
+func TestQuotePath(t *testing.T) {
+	for _, path := range []string{"dir/a.c", "bad dir/2.c", `bad "dir"/2.c`, "new\nline", `back\slash`} {
+		if actual := UnquotePath(QuotePath(path)); actual != path {
+			t.Errorf("test QuotePath error: expect: %q actual: %q", path, actual)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package rewrite
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+/*
+PathPattern matches file paths of the repository, the syntax is selected by prefix:
+
+	glob:PATTERN     '*' and '?' don't match '/', '**' matches any directories
+	regex:PATTERN    Go regular expression, searched in the whole path
+	literal:PATH     the exact path, or a directory and everything inside it
+	PATTERN          gitignore-style pattern (without any prefix):
+	                 a pattern without '/' matches at any level, 'dir/' only matches
+	                 directories, '**' matches any directories, and '!PATTERN'
+	                 re-includes paths matched by previous patterns
+
+All patterns match a directory and everything inside it.
+*/
+type PathPattern struct {
+	Syntax string // glob, regex, literal or gitignore
+	Negate bool   // only for gitignore-style
+	re     *regexp.Regexp
+}
+
+func ParsePathPattern(pattern string) (*PathPattern, error) {
+	p := &PathPattern{}
+	var expr string
+	if strings.HasPrefix(pattern, "regex:") {
+		p.Syntax = "regex"
+		expr = strings.TrimPrefix(pattern, "regex:")
+	} else if strings.HasPrefix(pattern, "glob:") {
+		p.Syntax = "glob"
+		expr = "^" + glob_to_regex(strings.Trim(strings.TrimPrefix(pattern, "glob:"), "/")) + "(/.*)?$"
+	} else if strings.HasPrefix(pattern, "literal:") {
+		p.Syntax = "literal"
+		expr = "^" + regexp.QuoteMeta(strings.Trim(strings.TrimPrefix(pattern, "literal:"), "/")) + "(/.*)?$"
+	} else {
+		p.Syntax = "gitignore"
+		if strings.HasPrefix(pattern, "!") {
+			p.Negate = true
+			pattern = pattern[1:]
+		} else if strings.HasPrefix(pattern, `\!`) || strings.HasPrefix(pattern, `\#`) {
+			pattern = pattern[1:]
+		}
+		dir_only := strings.HasSuffix(pattern, "/")
+		pattern = strings.TrimSuffix(pattern, "/")
+		// a pattern with a separator at the beginning or middle is relative to the root
+		anchored := strings.Contains(pattern, "/")
+		pattern = strings.TrimPrefix(pattern, "/")
+		if len(pattern) == 0 {
+			return nil, fmt.Errorf("empty path pattern")
+		}
+
+		expr = glob_to_regex(pattern)
+		if anchored {
+			expr = "^" + expr
+		} else {
+			expr = "^(.*/)?" + expr
+		}
+		if dir_only {
+			expr += "/.*$"
+		} else {
+			expr += "(/.*)?$"
+		}
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid path pattern %s: %s", pattern, err)
+	}
+	p.re = re
+	return p, nil
+}
+
+func (p *PathPattern) Match(path string) bool {
+	return p.re.MatchString(path)
+}
+
+// convert wildcards into regular expression
+func glob_to_regex(glob string) string {
+	var buf strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				if i+2 < len(glob) && glob[i+2] == '/' {
+					// "**/" matches zero or more directories
+					buf.WriteString("(.*/)?")
+					i += 2
+				} else {
+					buf.WriteString(".*")
+					i++
+				}
+			} else {
+				buf.WriteString("[^/]*")
+			}
+		case '?':
+			buf.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				buf.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			buf.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+				buf.WriteString(regexp.QuoteMeta(string(glob[i])))
+			}
+		default:
+			buf.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return buf.String()
+}
+
+// PathMatcher is a list of patterns, like a .gitignore file the last
+// matching pattern decides whether a path matches or not
+type PathMatcher []*PathPattern
+
+func NewPathMatcher(patterns []string) (PathMatcher, error) {
+	matcher := make(PathMatcher, 0, len(patterns))
+	for _, pattern := range patterns {
+		p, err := ParsePathPattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		matcher = append(matcher, p)
+	}
+	return matcher, nil
+}
+
+// Match reports whether the raw(unquoted) path matches
+func (matcher PathMatcher) Match(path string) bool {
+	matched := false
+	for _, p := range matcher {
+		if p.Match(path) {
+			matched = !p.Negate
+		}
+	}
+	return matched
+}
+
+// ReadPatternFile reads patterns line by line,
+// blank lines and lines starting with '#' are ignored
+func ReadPatternFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var patterns []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(strings.TrimSpace(line)) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns, scanner.Err()
+}
+
+// UnquotePath turns a path of the fast-export stream, which is C-style quoted
+// if it contains special characters, back into the raw path
+func UnquotePath(path string) string {
+	if len(path) > 1 && path[0] == '"' && path[len(path)-1] == '"' {
+		if raw, err := strconv.Unquote(path); err == nil {
+			return raw
+		}
+		return strings.ReplaceAll(path[1:len(path)-1], `\\`, `\`)
+	}
+	return path
+}
@@ -0,0 +1,59 @@
+package rewrite
+
+import (
+	"testing"
+)
+
+func TestPathMatcher(t *testing.T) {
+	var Data_t = []struct {
+		patterns []string
+		path     string
+		expected bool
+	}{
+		{[]string{"a.c"}, "a.c", true},
+		{[]string{"a.c"}, "dir/a.c", true},
+		{[]string{"a.c"}, "data.c.bak", false},
+		{[]string{"*.log"}, "logs/x.log", true},
+		{[]string{"dir/"}, "dir/sub/file", true},
+		{[]string{"dir/"}, "dir", false},
+		{[]string{"/a.c"}, "dir/a.c", false},
+		{[]string{"docs/**/*.png"}, "docs/a/b/c.png", true},
+		{[]string{"docs/**/*.png"}, "docs/c.png", true},
+		{[]string{"**/build"}, "x/build/out.o", true},
+		{[]string{"*.log", "!keep.log"}, "keep.log", false},
+		{[]string{"*.log", "!keep.log"}, "drop.log", true},
+		{[]string{"glob:*.c"}, "dir/a.c", false},
+		{[]string{"glob:**/*.c"}, "dir/a.c", true},
+		{[]string{"glob:dir"}, "dir/a.c", true},
+		{[]string{"regex:^a\\.c$"}, "data.c.bak", false},
+		{[]string{"regex:a\\.c"}, "dir/a.c", true},
+		{[]string{"regex:^dir/.*\\.c$"}, "dir/sub/a.c", true},
+		{[]string{"literal:a[1].c"}, "a[1].c", true},
+		{[]string{"literal:dir"}, "dir2/a.c", false},
+	}
+	for _, data := range Data_t {
+		matcher, err := NewPathMatcher(data.patterns)
+		if err != nil {
+			t.Fatalf("test NewPathMatcher error: %s", err)
+		}
+		if actual := matcher.Match(data.path); actual != data.expected {
+			t.Errorf("test PathMatcher error: %v on %s expect: %v actual: %v", data.patterns, data.path, data.expected, actual)
+		}
+	}
+}
+
+func TestUnquotePath(t *testing.T) {
+	var Data_t = []struct {
+		input    string
+		expected string
+	}{
+		{"dir/sub", "dir/sub"},
+		{`"bad \"dir\"/2.c"`, `bad "dir"/2.c`},
+		{`"\351\241\266\347\272\247"`, "顶级"},
+	}
+	for _, data := range Data_t {
+		if actual := UnquotePath(data.input); actual != data.expected {
+			t.Errorf("test UnquotePath error: expect: %v actual: %v", data.expected, actual)
+		}
+	}
+}
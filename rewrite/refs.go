@@ -0,0 +1,139 @@
+package rewrite
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	BranchPrefix = "refs/heads/"
+	TagPrefix    = "refs/tags/"
+)
+
+// RefRename renames refs starting with Old, which are full ref names like
+// "refs/tags/v", to start with New instead
+type RefRename struct {
+	Old string
+	New string
+}
+
+// ParseRefRename parses rule like "OLD:NEW" of '--branch-rename' or
+// '--tag-rename', the namespace is BranchPrefix or TagPrefix.
+// OLD and NEW are prefixes of the branch or tag names, an empty OLD adds
+// NEW to every name.
+func ParseRefRename(namespace, rule string) (RefRename, error) {
+	i := strings.Index(rule, ":")
+	if i < 0 {
+		return RefRename{}, fmt.Errorf("invalid ref rename %s, should be OLD:NEW", rule)
+	}
+	rename := RefRename{
+		Old: namespace + rule[:i],
+		New: namespace + rule[i+1:],
+	}
+	if rename.Old == rename.New {
+		return RefRename{}, fmt.Errorf("invalid ref rename %s, OLD and NEW are the same", rule)
+	}
+	return rename, nil
+}
+
+// Rename returns the new ref, or false if the ref doesn't start with Old
+func (rename RefRename) Rename(ref string) (string, bool) {
+	if !strings.HasPrefix(ref, rename.Old) {
+		return ref, false
+	}
+	return rename.New + ref[len(rename.Old):], true
+}
+
+// the ref may be a short tag name of the 'tag' command, or have the leading
+// space of parse_ref_line
+func full_ref_name(ref string) string {
+	ref = strings.TrimSpace(ref)
+	if !strings.HasPrefix(ref, "refs/") {
+		return TagPrefix + ref
+	}
+	return ref
+}
+
+// rename the ref by the first matched rule, the ref is kept in its form
+func rename_ref(renames []RefRename, ref string) string {
+	name := full_ref_name(ref)
+	short_tag := !strings.HasPrefix(strings.TrimSpace(ref), "refs/")
+	for _, rename := range renames {
+		if newname, ok := rename.Rename(name); ok {
+			if short_tag {
+				newname = strings.TrimPrefix(newname, TagPrefix)
+			}
+			return ref[:len(ref)-len(strings.TrimLeft(ref, " "))] + newname
+		}
+	}
+	return ref
+}
+
+// match_ref matches the full ref name with the spec, which is a ref name,
+// a glob, or a prefix of refs like "refs/heads/release".
+// Like git, '*' in a glob matches '/' too, so "refs/pull/*" matches
+// "refs/pull/1/head", and a spec without "refs/" may be a branch or a tag name.
+func match_ref(spec, ref string) bool {
+	candidates := []string{spec}
+	if !strings.HasPrefix(spec, "refs/") {
+		candidates = []string{BranchPrefix + spec, TagPrefix + spec, "refs/" + spec}
+	}
+	for _, candidate := range candidates {
+		candidate = strings.TrimSuffix(candidate, "/")
+		if ref == candidate || strings.HasPrefix(ref, candidate+"/") {
+			return true
+		}
+		if strings.ContainsAny(candidate, "*?") {
+			pattern := regexp.QuoteMeta(candidate)
+			pattern = strings.NewReplacer(`\*`, ".*", `\?`, ".").Replace(pattern)
+			if regexp.MustCompile("^" + pattern + "$").MatchString(ref) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ExpandRefs returns the refs selected by specs, a spec starting with '^' or
+// '!' excludes refs. If there are only exclusions, every other ref is
+// selected, e.g. []string{"^refs/pull/*"}.
+func (repo *Repository) ExpandRefs(specs []string) ([]string, error) {
+	var includes, excludes []string
+	for _, spec := range specs {
+		if strings.HasPrefix(spec, "^") || strings.HasPrefix(spec, "!") {
+			excludes = append(excludes, spec[1:])
+		} else {
+			includes = append(includes, spec)
+		}
+	}
+	all, err := repo.ShowRefs()
+	if err != nil {
+		return nil, err
+	}
+
+	var refs []string
+	for ref := range all {
+		matched := len(includes) == 0
+		for _, spec := range includes {
+			if match_ref(spec, ref) {
+				matched = true
+				break
+			}
+		}
+		for _, spec := range excludes {
+			if matched && match_ref(spec, ref) {
+				matched = false
+			}
+		}
+		if matched {
+			refs = append(refs, ref)
+		}
+	}
+	if len(refs) == 0 {
+		return nil, fmt.Errorf("no refs match %s", strings.Join(specs, " "))
+	}
+	sort.Strings(refs)
+	return refs, nil
+}
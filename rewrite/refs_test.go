@@ -0,0 +1,58 @@
+package rewrite
+
+import (
+	"testing"
+)
+
+func TestRenameRef(t *testing.T) {
+	var Data_t = []struct {
+		namespace string
+		rules     []string
+		ref       string
+		expected  string
+	}{
+		{TagPrefix, []string{"v:release-"}, " v1.0", " release-1.0"},
+		{TagPrefix, []string{"v:release-"}, " refs/tags/v1.0", " refs/tags/release-1.0"},
+		{TagPrefix, []string{"v:release-"}, " refs/heads/v1.0", " refs/heads/v1.0"},
+		{TagPrefix, []string{":old-"}, " v1.0", " old-v1.0"},
+		{BranchPrefix, []string{"feature/:"}, " refs/heads/feature/x", " refs/heads/x"},
+		{BranchPrefix, []string{"master:main"}, " refs/heads/master", " refs/heads/main"},
+		{BranchPrefix, []string{"dev/:feature/", "dev:develop"}, " refs/heads/dev/x", " refs/heads/feature/x"},
+	}
+	for _, data := range Data_t {
+		var renames []RefRename
+		for _, rule := range data.rules {
+			rename, err := ParseRefRename(data.namespace, rule)
+			if err != nil {
+				t.Fatalf("test ParseRefRename error: %s", err)
+			}
+			renames = append(renames, rename)
+		}
+		if actual := rename_ref(renames, data.ref); actual != data.expected {
+			t.Errorf("test rename_ref error: %v on %q expect: %q actual: %q", data.rules, data.ref, data.expected, actual)
+		}
+	}
+}
+
+func TestMatchRef(t *testing.T) {
+	var Data_t = []struct {
+		spec     string
+		ref      string
+		expected bool
+	}{
+		{"refs/heads/release/*", "refs/heads/release/1.0", true},
+		{"refs/heads/release/*", "refs/heads/release", false},
+		{"refs/pull", "refs/pull/1/head", true},
+		{"refs/pull/*", "refs/pull/1/head", true},
+		{"refs/heads/*.x", "refs/heads/a.x", true},
+		{"refs/heads/*.x", "refs/heads/axx", false},
+		{"main", "refs/heads/main", true},
+		{"v1.*", "refs/tags/v1.0", true},
+		{"main", "refs/heads/maint", false},
+	}
+	for _, data := range Data_t {
+		if actual := match_ref(data.spec, data.ref); actual != data.expected {
+			t.Errorf("test match_ref error: %s on %s expect: %v actual: %v", data.spec, data.ref, data.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package rewrite
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DefaultReplacement is used by rules without '==>'
+const DefaultReplacement = "***REMOVED***"
+
+/*
+ReplaceRule replaces text in blob data, one rule per line in a rules file:
+
+	PASSWORD                  literal text, replaced by ***REMOVED***
+	PASSWORD==>xxxxxx         literal text, replaced by xxxxxx
+	glob:pass*word==>xxxxxx   '*' and '?' don't match line breaks
+	regex:(key=)\w+==>${1}xx  Go regular expression, '$1' or '${1}' refers to a submatch
+	literal:regex:abc         use 'literal:' if the text itself starts with a prefix
+
+Blank lines and lines starting with '#' are ignored.
+*/
+type ReplaceRule struct {
+	Syntax      string // literal, glob or regex
+	Old         []byte // literal text
+	Replacement []byte
+	re          *regexp.Regexp
+}
+
+func ParseReplaceRule(line string) (*ReplaceRule, error) {
+	rule := &ReplaceRule{
+		Syntax:      "literal",
+		Replacement: []byte(DefaultReplacement),
+	}
+	if i := strings.LastIndex(line, "==>"); i >= 0 {
+		rule.Replacement = []byte(line[i+3:])
+		line = line[:i]
+	}
+
+	var expr string
+	if strings.HasPrefix(line, "regex:") {
+		rule.Syntax = "regex"
+		expr = strings.TrimPrefix(line, "regex:")
+	} else if strings.HasPrefix(line, "glob:") {
+		rule.Syntax = "glob"
+		expr = glob_to_text_regex(strings.TrimPrefix(line, "glob:"))
+	} else {
+		line = strings.TrimPrefix(line, "literal:")
+		rule.Old = []byte(line)
+	}
+	if len(line) == 0 {
+		return nil, fmt.Errorf("empty replace text rule")
+	}
+	if rule.Syntax != "literal" {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid replace text rule %s: %s", line, err)
+		}
+		rule.re = re
+	}
+	return rule, nil
+}
+
+// convert wildcards into regular expression which matches text within a line
+func glob_to_text_regex(glob string) string {
+	var buf strings.Builder
+	for _, c := range glob {
+		switch c {
+		case '*':
+			buf.WriteString(`[^\n]*`)
+		case '?':
+			buf.WriteString(`[^\n]`)
+		default:
+			buf.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return buf.String()
+}
+
+func (rule *ReplaceRule) Replace(data []byte) []byte {
+	if rule.Syntax == "literal" {
+		return bytes.ReplaceAll(data, rule.Old, rule.Replacement)
+	}
+	return rule.re.ReplaceAll(data, rule.Replacement)
+}
+
+// ReadReplaceRules reads the rules file of '--replace-text'
+func ReadReplaceRules(path string) ([]*ReplaceRule, error) {
+	patterns, err := ReadPatternFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rules := make([]*ReplaceRule, 0, len(patterns))
+	for _, pattern := range patterns {
+		rule, err := ParseReplaceRule(pattern)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// replace_text applies every rule in order, returns false if nothing changed
+func replace_text(rules []*ReplaceRule, data []byte) ([]byte, bool) {
+	replaced := data
+	for _, rule := range rules {
+		replaced = rule.Replace(replaced)
+	}
+	return replaced, !bytes.Equal(replaced, data)
+}
@@ -0,0 +1,29 @@
+package rewrite
+
+import (
+	"testing"
+)
+
+func TestReplaceRule(t *testing.T) {
+	var Data_t = []struct {
+		rule     string
+		input    string
+		expected string
+	}{
+		{"hunter2", "password=hunter2\n", "password=***REMOVED***\n"},
+		{"hunter2==>xxx", "a hunter2 b hunter2", "a xxx b xxx"},
+		{"literal:a.c==>b", "a.c abc", "b abc"},
+		{"glob:key-*==>key-xxx", "key-123\nkey-456\n", "key-xxx\nkey-xxx\n"},
+		{`regex:(password=)\w+==>${1}xxx`, "password=abc123;", "password=xxx;"},
+		{"==>==>x", "a==>b", "axb"},
+	}
+	for _, data := range Data_t {
+		rule, err := ParseReplaceRule(data.rule)
+		if err != nil {
+			t.Fatalf("test ParseReplaceRule error: %s", err)
+		}
+		if actual := string(rule.Replace([]byte(data.input))); actual != data.expected {
+			t.Errorf("test ReplaceRule error: %s on %q expect: %q actual: %q", data.rule, data.input, data.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package rewrite
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+)
+
+// CommitRecord identifies a commit of the original history
+type CommitRecord struct {
+	OriginalOid string
+	Branch      string
+	Subject     string // first line of the commit message
+}
+
+func NewCommitRecord(commit *Commit) CommitRecord {
+	subject := commit.Message
+	if i := bytes.IndexByte(subject, '\n'); i >= 0 {
+		subject = subject[:i]
+	}
+	return CommitRecord{
+		OriginalOid: commit.OriginalOid,
+		Branch:      strings.TrimSpace(commit.Branch),
+		Subject:     string(subject),
+	}
+}
+
+// Report records what a rewrite has changed, it's filled by the Rewriter
+// whether the run is a dry run or not.
+type Report struct {
+	DroppedCommits   []CommitRecord          // commits which became empty, or lost their parent
+	RewrittenCommits []CommitRecord          // commits whose filechanges, message or identity changed
+	RemovedFiles     map[string][]FileChange // branch => filechanges removed from it
+	SkippedResets    []string                // refs of skipped resets
+	SkippedTags      []string                // names of skipped tags
+	DeletedRefs      []string                // refs with no commit left, deleted after the rewrite
+	RenamedRefs      map[string]string       // old ref => new ref, old refs are deleted after the rewrite
+	// RemovedBlobs are the oids referenced by removed filechanges, only
+	// known when the stream carries no data(filechanges refer to oids)
+	RemovedBlobs map[string]bool
+	// KeptBlobs are the oids still referenced by kept filechanges, a
+	// removed blob which is kept elsewhere isn't freed, see FreedBlobs
+	KeptBlobs map[string]bool
+	// RedactedBlobs are the original oids of blobs changed by ReplaceText
+	RedactedBlobs []string
+	// ExportedBlobs are the original oids of LFS pointers replaced by
+	// their objects, see LFSExporter
+	ExportedBlobs []string
+	// MissingLFSObjects are the LFS pointers kept as they are, since their
+	// objects are not in the LFS storage
+	MissingLFSObjects []LFSObject
+	// FreedBytes is the size of dropped or shrunk blobs, only known when
+	// the stream carries data
+	FreedBytes int64
+}
+
+func NewReport() *Report {
+	return &Report{
+		RemovedFiles: make(map[string][]FileChange),
+		RemovedBlobs: make(map[string]bool),
+		KeptBlobs:    make(map[string]bool),
+		RenamedRefs:  make(map[string]string),
+	}
+}
+
+func (report *Report) removeFile(filechange *FileChange) {
+	branch := strings.TrimSpace(filechange.Branch)
+	report.RemovedFiles[branch] = append(report.RemovedFiles[branch], *filechange)
+	if filechange.ChangeType == "M" && len(filechange.BlobID) == 40 {
+		report.RemovedBlobs[filechange.BlobID] = true
+	}
+}
+
+// FreedBlobs returns the removed blobs which no kept filechange refers to,
+// they are gone from the rewritten history
+func (report *Report) FreedBlobs() []string {
+	var freed []string
+	for oid := range report.RemovedBlobs {
+		if !report.KeptBlobs[oid] {
+			freed = append(freed, oid)
+		}
+	}
+	sort.Strings(freed)
+	return freed
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gitee.com/oscstudio/git-repo-clean/rewrite"
+)
+
+// blobs larger than this are not scanned for secrets, they are hardly text files
+const SECRET_SCAN_MAX_SIZE = 5 * 1024 * 1024
+
+// min entropy(bits per char) of a high-entropy string
+const SECRET_MIN_ENTROPY = 4.5
+
+type SecretRule struct {
+	name  string
+	re    *regexp.Regexp
+	group int // the submatch which is the secret, 0 means the whole match
+}
+
+var DefaultSecretRules = []SecretRule{
+	{"aws-access-key", regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`), 0},
+	{"aws-secret-key", regexp.MustCompile(`(?i)aws_?secret_?access_?key["']?\s*[:=]\s*["']?([A-Za-z0-9/+]{40})\b`), 1},
+	// take the whole key block if it's complete, otherwise the header only
+	{"private-key", regexp.MustCompile(`(?s)-----BEGIN[ A-Z]*PRIVATE KEY( BLOCK)?-----(.*?-----END[ A-Z]*PRIVATE KEY( BLOCK)?-----)?`), 0},
+	{"jwt", regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`), 0},
+}
+
+var high_entropy_re = regexp.MustCompile(`[A-Za-z0-9+/_-]{20,}={0,2}`)
+
+// name of a custom rule, e.g. "slack-token:xox[bp]-[0-9A-Za-z-]+"
+var secret_rule_name_re = regexp.MustCompile(`^[\w-]+$`)
+
+// SecretFinding is a secret found in a blob
+type SecretFinding struct {
+	oid    string
+	rule   string
+	secret string
+	line   int
+}
+
+// SecretBlob is a blob which contains secrets
+type SecretBlob struct {
+	oid          string
+	objectName   string
+	paths        []string
+	first_commit string
+	branches     []string
+	findings     []SecretFinding
+}
+
+// ReadSecretRules reads custom rules of '--secret-rules', one per line,
+// like 'NAME:REGEX' or just 'REGEX'
+func ReadSecretRules(path string) ([]SecretRule, error) {
+	lines, err := rewrite.ReadPatternFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []SecretRule
+	for _, line := range lines {
+		name := "custom"
+		if i := strings.Index(line, ":"); i > 0 && secret_rule_name_re.MatchString(line[:i]) {
+			name, line = line[:i], line[i+1:]
+		}
+		re, err := regexp.Compile(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid secret rule %s: %s", line, err)
+		}
+		rules = append(rules, SecretRule{name, re, 0})
+	}
+	return rules, nil
+}
+
+// Shannon entropy of the string, in bits per char
+func entropy(s string) float64 {
+	counts := make(map[rune]int)
+	for _, c := range s {
+		counts[c]++
+	}
+	var e float64
+	n := float64(len(s))
+	for _, count := range counts {
+		p := float64(count) / n
+		e -= p * math.Log2(p)
+	}
+	return e
+}
+
+// a random token has upper and lower case letters and digits, long words or
+// paths hardly have all of them
+func is_random_token(s string) bool {
+	var upper, lower, digit bool
+	for _, c := range s {
+		switch {
+		case c >= 'A' && c <= 'Z':
+			upper = true
+		case c >= 'a' && c <= 'z':
+			lower = true
+		case c >= '0' && c <= '9':
+			digit = true
+		}
+	}
+	return upper && lower && digit && entropy(s) >= SECRET_MIN_ENTROPY
+}
+
+// FindSecrets returns the secrets in data, matched by every rule and
+// the high-entropy detector
+func FindSecrets(oid string, data []byte, rules []SecretRule) []SecretFinding {
+	var findings []SecretFinding
+	seen := make(map[string]bool)
+	add := func(rule string, start int, secret string) {
+		if seen[secret] {
+			return
+		}
+		seen[secret] = true
+		line := bytes.Count(data[:start], []byte("\n")) + 1
+		findings = append(findings, SecretFinding{oid, rule, secret, line})
+	}
+
+	for _, rule := range rules {
+		for _, loc := range rule.re.FindAllSubmatchIndex(data, -1) {
+			start, end := loc[2*rule.group], loc[2*rule.group+1]
+			add(rule.name, start, string(data[start:end]))
+		}
+	}
+	for _, loc := range high_entropy_re.FindAllIndex(data, -1) {
+		token := string(data[loc[0]:loc[1]])
+		if is_random_token(strings.TrimRight(token, "=")) {
+			add("high-entropy", loc[0], token)
+		}
+	}
+	return findings
+}
+
+// hide most of the secret, so that the scan result won't leak it again
+func MaskSecret(secret string) string {
+	if i := strings.IndexByte(secret, '\n'); i >= 0 {
+		secret = secret[:i]
+	}
+	n := len(secret) / 4
+	if n > 6 {
+		n = 6
+	}
+	return secret[:n] + strings.Repeat("*", 8)
+}
+
+// ScanSecrets streams the blobs reachable from the refs to be rewritten via
+// 'git cat-file --batch' and looks for secrets, the other blobs are never
+// touched by the rewrite
+func ScanSecrets(context *Context, rules []SecretRule) ([]*SecretBlob, error) {
+	if context.opts.verbose {
+		PrintLocalWithGreenln("start scanning")
+	}
+	revs, err := context.ScanRevs()
+	if err != nil {
+		return nil, err
+	}
+	blob_history, err := GetBlobHistory(context.gitBin, context.workDir, revs)
+	if err != nil {
+		return nil, err
+	}
+	var oids []string
+	for oid := range blob_history {
+		size, ok := context.blob_size_list[oid]
+		if !ok {
+			continue
+		}
+		if s, _ := strconv.ParseUint(size, 10, 64); s <= SECRET_SCAN_MAX_SIZE {
+			oids = append(oids, oid)
+		}
+	}
+	sort.Strings(oids)
+
+	var blobs []*SecretBlob
+	err = CatBlobs(context.gitBin, context.workDir, oids, func(oid string, data []byte) {
+		// skip binary files
+		head := data
+		if len(head) > 8000 {
+			head = head[:8000]
+		}
+		if bytes.IndexByte(head, 0) >= 0 {
+			return
+		}
+		if findings := FindSecrets(oid, data, rules); len(findings) != 0 {
+			blobs = append(blobs, &SecretBlob{oid: oid, findings: findings})
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, blob := range blobs {
+		history := blob_history[blob.oid]
+		blob.paths = history.paths
+		blob.objectName = strings.Join(blob.paths, ", ")
+		blob.first_commit = history.FirstCommit()
+		blob.branches = BranchesContaining(context.gitBin, context.workDir, history.commits)
+	}
+	sort.Slice(blobs, func(i, j int) bool {
+		return blobs[i].objectName < blobs[j].objectName
+	})
+	return blobs, nil
+}
+
+func ShowSecretsResult(blobs []*SecretBlob) {
+	PrintLocalWithGreenln("scan done!")
+	fmt.Println()
+	for _, blob := range blobs {
+		PrintYellowln(fmt.Sprintf("%s %s", blob.oid, blob.objectName))
+		for _, finding := range blob.findings {
+			fmt.Printf("    %s: %-16s %s\n", LocalPrinter().Sprintf("line %d", finding.line), finding.rule, MaskSecret(finding.secret))
+		}
+		if blob.first_commit != "" {
+			fmt.Printf("    %s\n", LocalPrinter().Sprintf("first commit: %s, branches: %s", blob.first_commit, strings.Join(blob.branches, ", ")))
+		}
+	}
+	fmt.Println()
+}
+
+// SecretsMode scans secrets, then selects the blobs to be deleted, or
+// generates the replace text rules to redact the secrets
+func SecretsMode(ctx *Context) (result []string) {
+	rules := DefaultSecretRules
+	if ctx.opts.secretrules != "" {
+		custom, err := ReadSecretRules(ctx.opts.secretrules)
+		if err != nil {
+			ft := LocalPrinter().Sprintf("read secret rules error: %s", err)
+			PrintRedln(ft)
+			os.Exit(1)
+		}
+		rules = append(append([]SecretRule{}, rules...), custom...)
+	}
+	blobs, err := ScanSecrets(ctx, rules)
+	if err != nil {
+		ft := LocalPrinter().Sprintf("scanning repository error: %s", err)
+		PrintRedln(ft)
+		os.Exit(1)
+	}
+	if len(blobs) == 0 {
+		PrintLocalWithGreenln("no secrets were found")
+		os.Exit(1)
+	}
+	ShowSecretsResult(blobs)
+	if ctx.opts.interact {
+		blobs = SelectSecrets(blobs)
+	}
+
+	for _, blob := range blobs {
+		if ctx.opts.redact {
+			for _, finding := range blob.findings {
+				ctx.redactions = append(ctx.redactions, &rewrite.ReplaceRule{
+					Syntax:      "literal",
+					Old:         []byte(finding.secret),
+					Replacement: []byte(rewrite.DefaultReplacement),
+				})
+			}
+		} else {
+			result = append(result, blob.oid)
+			for _, path := range blob.paths {
+				ctx.files_changed.Add(path)
+			}
+		}
+	}
+	return result
+}
+
+func secret_option(blob *SecretBlob, finding SecretFinding) string {
+	return fmt.Sprintf("%s: %s %s %s %s", blob.oid, blob.objectName,
+		LocalPrinter().Sprintf("line %d", finding.line), finding.rule, MaskSecret(finding.secret))
+}
+
+// SelectSecrets asks the user to select and confirm the findings to act on,
+// the blobs without any selected finding are left untouched
+func SelectSecrets(blobs []*SecretBlob) []*SecretBlob {
+	var options []string
+	for _, blob := range blobs {
+		for _, finding := range blob.findings {
+			options = append(options, secret_option(blob, finding))
+		}
+	}
+	selected := MultiSelect(LocalSprintf("multi select secrets message"), options)
+	if len(selected) == 0 {
+		PrintLocalWithRedln("no secrets were selected")
+		os.Exit(1)
+	}
+	if !ConfirmSecrets() {
+		PrintLocalWithRedln("operation aborted")
+		os.Exit(1)
+	}
+	chosen := make(map[string]bool)
+	for _, option := range selected {
+		chosen[option] = true
+	}
+	var result []*SecretBlob
+	for _, blob := range blobs {
+		var findings []SecretFinding
+		for _, finding := range blob.findings {
+			if chosen[secret_option(blob, finding)] {
+				findings = append(findings, finding)
+			}
+		}
+		if len(findings) != 0 {
+			blob.findings = findings
+			result = append(result, blob)
+		}
+	}
+	return result
+}
@@ -2,8 +2,11 @@ package main
 
 import (
 	"fmt"
+	"io"
+	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // Convert number to bytes according to Uint
@@ -37,7 +40,31 @@ func UnitConvert(input string) (uint64, error) {
 func ShowScanResult(list BlobList) {
 	PrintLocalWithGreenln("scan done!")
 	PrintLocalWithYellowln("note that there may be multiple versions of the same file")
+	fmt.Println()
+	WriteScanTable(os.Stdout, list)
+	fmt.Println()
+}
+
+// ShowUnreachableResult shows the first number blobs which are above the
+// limit, but not reachable from the scanned refs, so they are not in the
+// scan result and are not removed by the rewrite
+func ShowUnreachableResult(list BlobList, number uint32) {
+	if len(list) == 0 {
+		return
+	}
+	PrintYellowln(LocalPrinter().Sprintf("blobs not reachable from the scanned refs: %d", len(list)))
+	PrintLocalWithYellowln("they are unreachable objects or only on the other branches, and will not be removed")
+	if len(list) > int(number) {
+		list = list[:number]
+	}
+	for _, item := range list {
+		fmt.Printf("  %s %d bytes (%d bytes on disk)\n", item.oid, item.objectSize, item.diskSize)
+	}
+	fmt.Println()
+}
 
+// WriteScanTable writes the scan result as a table
+func WriteScanTable(w io.Writer, list BlobList) {
 	// if maxNameLen = 58 maxUTF8NameLen = 34, then ActualLen = (58-34)/2
 	maxNameLen, maxUTF8NameLen := maxLenBlobName(list)
 	ActualLen := maxUTF8NameLen + (maxNameLen-maxUTF8NameLen)/2
@@ -46,25 +73,90 @@ func ShowScanResult(list BlobList) {
 	if ActualLen < 9 {
 		ActualLen = 9
 	}
+	// the raw size and the on-disk size share the same width
 	maxSizeLen := maxLenBlobSize(list)
 	// fix for too small file size
 	if maxSizeLen < 4 {
 		maxSizeLen = 4
 	}
-	fmt.Println()
-	fmt.Printf("|-%-*s | %-*s------ | %-*s-|\n", 40, strings.Repeat("-", 40), maxSizeLen, strings.Repeat("-", maxSizeLen), ActualLen, strings.Repeat("-", ActualLen))
-	fmt.Printf("| %-*s | %-*s bytes | %-*s |\n", 40, "Blob ID", maxSizeLen, "SIZE", ActualLen, "File Name")
-	fmt.Printf("|-%-*s | %-*s------ | %-*s-|\n", 40, strings.Repeat("-", 40), maxSizeLen, strings.Repeat("-", maxSizeLen), ActualLen, strings.Repeat("-", ActualLen))
+	// where the blob comes from, see LookupRefs()
+	history := NewTableColumns("FIRST COMMIT", "AUTHOR", "DATE", "LAST COMMIT", "REFS")
 	for _, item := range list {
+		first := BlobHistory{commits: item.commits}
+		var date string
+		if item.date != 0 {
+			date = time.Unix(item.date, 0).Format("2006-01-02")
+		}
+		refs := item.branches
+		for _, tag := range item.tags {
+			refs = append(refs, "tag: "+tag)
+		}
+		history.Add(AbbrevOid(first.FirstCommit()), item.author, date, AbbrevOid(item.lastCommit), strings.Join(refs, ", "))
+	}
+	line := strings.Repeat("-", maxSizeLen)
+	fmt.Fprintf(w, "|-%-*s | %-*s------ | %-*s------ | %-*s-|%s\n", 40, strings.Repeat("-", 40), maxSizeLen, line, maxSizeLen, line, ActualLen, strings.Repeat("-", ActualLen), history.Line())
+	fmt.Fprintf(w, "| %-*s | %-*s bytes | %-*s bytes | %-*s |%s\n", 40, "Blob ID", maxSizeLen, "SIZE", maxSizeLen, "DISK", ActualLen, "File Name", history.Row(-1))
+	fmt.Fprintf(w, "|-%-*s | %-*s------ | %-*s------ | %-*s-|%s\n", 40, strings.Repeat("-", 40), maxSizeLen, line, maxSizeLen, line, ActualLen, strings.Repeat("-", ActualLen), history.Line())
+	for i, item := range list {
 		d := len(item.objectName) - len([]rune(item.objectName))
-		if d != 0 {
-			fmt.Printf("| %.*s | %.*d bytes | %-*s |\n", 40, item.oid, maxSizeLen, item.objectSize, ActualLen-d/2, item.objectName)
-		} else {
-			fmt.Printf("| %.*s | %.*d bytes | %-*s |\n", 40, item.oid, maxSizeLen, item.objectSize, ActualLen, item.objectName)
+		fmt.Fprintf(w, "| %.*s | %*d bytes | %*d bytes | %-*s |%s\n", 40, item.oid, maxSizeLen, item.objectSize, maxSizeLen, item.diskSize, ActualLen-d/2, item.objectName, history.Row(i))
+	}
+	fmt.Fprintf(w, "|-%-*s | %-*s------ | %-*s------ | %-*s-|%s\n", 40, strings.Repeat("-", 40), maxSizeLen, line, maxSizeLen, line, ActualLen, strings.Repeat("-", ActualLen), history.Line())
+}
+
+// TableColumns are the columns appended to a table, the cells are padded
+// by the width on the terminal, see display_width
+type TableColumns struct {
+	headers []string
+	widths  []int
+	rows    [][]string
+}
+
+func NewTableColumns(headers ...string) *TableColumns {
+	columns := &TableColumns{headers: headers}
+	for _, header := range headers {
+		columns.widths = append(columns.widths, display_width(header))
+	}
+	return columns
+}
+
+func (columns *TableColumns) Add(cells ...string) {
+	for i, cell := range cells {
+		if n := display_width(cell); n > columns.widths[i] {
+			columns.widths[i] = n
 		}
 	}
-	fmt.Printf("|-%-*s | %-*s------ | %-*s-|\n", 40, strings.Repeat("-", 40), maxSizeLen, strings.Repeat("-", maxSizeLen), ActualLen, strings.Repeat("-", ActualLen))
-	fmt.Println()
+	columns.rows = append(columns.rows, cells)
+}
+
+// Row returns the cells of the i-th row like " a | b |", or the headers if i < 0
+func (columns *TableColumns) Row(i int) string {
+	cells := columns.headers
+	if i >= 0 {
+		cells = columns.rows[i]
+	}
+	var row strings.Builder
+	for j, cell := range cells {
+		row.WriteString(" " + cell + strings.Repeat(" ", columns.widths[j]-display_width(cell)) + " |")
+	}
+	return row.String()
+}
+
+// Line returns the separator like " --- | --- |"
+func (columns *TableColumns) Line() string {
+	var line strings.Builder
+	for _, width := range columns.widths {
+		line.WriteString(" " + strings.Repeat("-", width) + " |")
+	}
+	return line.String()
+}
+
+// AbbrevOid abbreviates the commit oid like 'git log --oneline'
+func AbbrevOid(oid string) string {
+	if len(oid) > 10 {
+		return oid[:10]
+	}
+	return oid
 }
 
 func maxLenBlobName(list BlobList) (int, int) {
@@ -84,8 +176,18 @@ func maxLenBlobName(list BlobList) (int, int) {
 }
 
 func maxLenBlobSize(list BlobList) int {
-	// the first one is the biggest one
-	return len(strconv.Itoa(int(list[0].objectSize)))
+	// the list may be sorted by either size, and the on-disk size
+	// of a small blob may be larger than its raw size
+	var max uint64
+	for _, item := range list {
+		if item.objectSize > max {
+			max = item.objectSize
+		}
+		if item.diskSize > max {
+			max = item.diskSize
+		}
+	}
+	return len(strconv.FormatUint(max, 10))
 }
 
 func EndcodePath(path string) string {
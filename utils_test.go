@@ -28,14 +28,35 @@ func TestUnitConvert(t *testing.T) {
 func TestShowScanResult(t *testing.T) {
 	var Data_t = []HistoryRecord{
 		// for test, the first one is the biggest one
-		{"4fd1482c27853b935c11108688f63e3f4f0f9c80", 100000, "loooooooooooooooooooooooooong file"},
-		{"e288c8793273629cf7a0679f4410eaf74c7108f0", 10, "short file1"},
-		{"5266b09a8b363e8c50ec25488c821c441c3809a0", 100, "looooooong file"},
-		{"4fd1482c27853b935c11108688f63e3f4f0f9c80", 1000, "looooooooooooooong file"},
+		NewHistoryRecord("4fd1482c27853b935c11108688f63e3f4f0f9c80", 100000, 2000, &BlobHistory{paths: []string{"loooooooooooooooooooooooooong file"}}),
+		NewHistoryRecord("e288c8793273629cf7a0679f4410eaf74c7108f0", 10, 25, &BlobHistory{paths: []string{"short file1"}}),
+		NewHistoryRecord("5266b09a8b363e8c50ec25488c821c441c3809a0", 100, 90, &BlobHistory{paths: []string{"looooooong file", "moved/looooooong file"}}),
+		NewHistoryRecord("4fd1482c27853b935c11108688f63e3f4f0f9c80", 1000, 300, &BlobHistory{paths: []string{"looooooooooooooong file"}}),
 	}
 	ShowScanResult(Data_t)
 }
 
+func TestMatchFileType(t *testing.T) {
+	var Data_t = []struct {
+		paths    []string
+		types    string
+		expected bool
+	}{
+		{[]string{"a.zip"}, "zip", true},
+		{[]string{"dir/a.tar.gz"}, "tar.gz", true},
+		{[]string{"a.psd", "b.png"}, "so, png", true},
+		{[]string{"a.psd"}, ".psd", true},
+		{[]string{"zip"}, "zip", false},
+		{[]string{"a.zip"}, "so,,", false},
+	}
+	for _, data := range Data_t {
+		actual := MatchFileType(data.paths, data.types)
+		if actual != data.expected {
+			t.Errorf("test MatchFileType error: %v %s expect: %v actual: %v", data.paths, data.types, data.expected, actual)
+		}
+	}
+}
+
 func TestEndcodePath(t *testing.T) {
 	var Data_t = []struct {
 		input    string